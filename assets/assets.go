@@ -0,0 +1,120 @@
+// Package assets gives built files content-hashed names, so that they
+// can be cached forever, and keeps the manifest templates look them up in.
+package assets
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// HashLength is how many hex digits of the SHA-256 go into a name.
+const HashLength = 10
+
+// ManifestName is the manifest's file name in the output directory.
+const ManifestName = "assets.json"
+
+// Manifest maps output names, such as "index.css" or "index.js.fr_FR",
+// to their fingerprinted copies.
+type Manifest struct {
+	lock  sync.RWMutex
+	Files map[string]string
+}
+
+// NewManifest returns an empty Manifest.
+func NewManifest() *Manifest {
+	return &Manifest{Files: make(map[string]string)}
+}
+
+// Hashed puts sum into name before its first extension:
+// "js/index.js.fr_FR" becomes "js/index.SUM.js.fr_FR".
+func Hashed(name string, sum string) string {
+	dir, base := filepath.Split(name)
+	if i := strings.Index(base, "."); i > 0 {
+		return dir + base[:i] + "." + sum + base[i:]
+	}
+	return dir + base + "." + sum
+}
+
+// Add fingerprints name, an output under dir: it and its other forms
+// (such as the gzipped copy), if they exist, are copied to names holding
+// the hash of name's contents.
+func (m *Manifest) Add(dir string, name string, others ...string) error {
+	b, err := ioutil.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return err
+	}
+	h := sha256.Sum256(b)
+	sum := hex.EncodeToString(h[:])[:HashLength]
+
+	for _, n := range append([]string{name}, others...) {
+		src := filepath.Join(dir, n)
+		content, err := ioutil.ReadFile(src)
+		if os.IsNotExist(err) && n != name {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, Hashed(n, sum)), content, 0644); err != nil {
+			return err
+		}
+	}
+
+	m.lock.Lock()
+	m.Files[name] = Hashed(name, sum)
+	m.lock.Unlock()
+	return nil
+}
+
+// URL returns the fingerprinted URL for name.  The copy for locale
+// (name.LOCALE) is preferred, so that "index.js" finds the right
+// translation.
+func (m *Manifest) URL(name string, locale string) (string, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	name = strings.TrimPrefix(name, "/")
+	if h, ok := m.Files[name+"."+locale]; ok {
+		return "/" + h, nil
+	}
+	if h, ok := m.Files[name]; ok {
+		return "/" + h, nil
+	}
+	return "", fmt.Errorf("asset %q was not built; is its pipeline rule marked Fingerprint?", name)
+}
+
+// Sum returns the hash name was fingerprinted with, if it was, so that
+// its other forms can be found with Hashed.
+func (m *Manifest) Sum(name string) (string, bool) {
+	m.lock.RLock()
+	h, ok := m.Files[name]
+	m.lock.RUnlock()
+	if !ok {
+		return "", false
+	}
+	base, hashed := filepath.Base(name), filepath.Base(h)
+	i := strings.Index(base, ".")
+	if i <= 0 {
+		i = len(base)
+	}
+	return hashed[i+1 : i+1+HashLength], true
+}
+
+// JSON returns the manifest as a JSON object of name to fingerprinted name.
+func (m *Manifest) JSON() []byte {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	b, _ := json.MarshalIndent(m.Files, "", "  ")
+	return append(b, '\n')
+}
+
+// Save writes the manifest into dir.
+func (m *Manifest) Save(dir string) error {
+	return ioutil.WriteFile(filepath.Join(dir, ManifestName), m.JSON(), 0644)
+}
@@ -0,0 +1,80 @@
+package assets
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHashed(t *testing.T) {
+	for _, tt := range []struct{ in, out string }{
+		{"index.css", "index.abc.css"},
+		{"index.js.fr_FR", "index.abc.js.fr_FR"},
+		{"js/index.js.gz.fr_FR", "js/index.abc.js.gz.fr_FR"},
+		{"README", "README.abc"},
+	} {
+		if got := Hashed(tt.in, "abc"); got != tt.out {
+			t.Errorf("Hashed(%q) = %q, want %q", tt.in, got, tt.out)
+		}
+	}
+}
+
+func TestManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "assets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"index.css":         "body {}",
+		"index.css.gz":      "zipped",
+		"index.js.en_US":    "english",
+		"index.js.fr_FR":    "french",
+		"index.js.gz.fr_FR": "zipped french",
+	}
+	for name, content := range files {
+		ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+	}
+
+	m := NewManifest()
+	for _, add := range [][]string{
+		{"index.css", "index.css.gz"},
+		{"index.js.en_US", "index.js.gz.en_US"},
+		{"index.js.fr_FR", "index.js.gz.fr_FR"},
+	} {
+		if err := m.Add(dir, add[0], add[1:]...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fr, err := m.URL("index.js", "fr_FR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	en, _ := m.URL("/index.js", "en_US")
+	if fr == en || !strings.HasSuffix(fr, ".js.fr_FR") || !strings.HasPrefix(fr, "/index.") {
+		t.Errorf("index.js: fr %q, en %q", fr, en)
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(dir, fr)); err != nil || string(b) != "french" {
+		t.Errorf("%s: %q %v", fr, b, err)
+	}
+	gz := strings.Replace(fr, ".js.", ".js.gz.", 1)
+	if b, err := ioutil.ReadFile(filepath.Join(dir, gz)); err != nil || string(b) != "zipped french" {
+		t.Errorf("%s: %q %v", gz, b, err)
+	}
+
+	css, _ := m.URL("index.css", "fr_FR")
+	if _, err := os.Stat(filepath.Join(dir, css+".gz")); err != nil {
+		t.Errorf("no gzipped copy of %s", css)
+	}
+	if _, err := m.URL("missing.css", "en_US"); err == nil {
+		t.Errorf("missing.css: no error")
+	}
+
+	sum, ok := m.Sum("index.js.fr_FR")
+	if !ok || "/"+Hashed("index.js.fr_FR", sum) != fr {
+		t.Errorf("Sum: %q %v", sum, ok)
+	}
+}
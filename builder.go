@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
 	"io/ioutil"
@@ -8,17 +9,47 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/falling-sky/builder/config"
 	"github.com/falling-sky/builder/fileutil"
-	"github.com/falling-sky/builder/gitinfo"
 	"github.com/falling-sky/builder/job"
-	"github.com/falling-sky/builder/po"
-	"github.com/falling-sky/builder/signature"
+	"github.com/falling-sky/builder/manifest"
+	"github.com/falling-sky/builder/minify"
+	"github.com/falling-sky/builder/output"
+	"github.com/falling-sky/builder/serve"
+	"github.com/falling-sky/builder/sites"
+	"github.com/falling-sky/builder/tfuncs"
 )
 
 var configFileName = flag.String("config", "", "config file location (see --example)")
 var configHelp = flag.Bool("example", false, "Dump a configuration example to the screen.")
+var depsFileName = flag.String("deps", "", "write the template include graph to this file")
+var explain = flag.Bool("explain", false, "say why each template was, or wasn't, rebuilt")
+var profileName = flag.String("profile", "", "config profile to build, such as dev or production")
+var listenAddr = flag.String("listen", "", "address for \"serve\", or for watch to serve with live reload (default localhost:8080 for serve)")
+var configSets stringList
+
+// version is the builder's release, for the manifest; set it when linking,
+// with -ldflags "-X main.version=v1.2.3".
+var version = "devel"
+
+func init() {
+	flag.Var(&configSets, "set", "override a config setting, as Path=value (repeatable)")
+}
+
+// stringList collects the values of a flag given more than once.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
 
 func copyHelper(source string, dest string, fn func(string) ([]string, error)) {
 	files, err := fn(source)
@@ -63,170 +94,211 @@ func copyFilesAll(source string, dest string) {
 	copyHelper(source, dest, fileutil.FilesInDirRecursive)
 }
 
-func prepOutput(dir string) {
-	log.Printf("Prepping %s\n", dir)
-	if dir == "" {
-		log.Fatal("dir empty, unexpected")
+// postInfo turns a pipeline rule into what the job queue needs.
+func postInfo(conf *config.Record, rule *config.Rule) job.PostInfoType {
+	steps, _ := conf.ProcessorSteps(rule.Processor)
+	encodings := rule.Encodings()
+	if conf.Options.NoCompress {
+		encodings = nil
+	}
+	return job.PostInfoType{
+		Directory:   rule.Directory,
+		PostProcess: steps,
+		Minify:      rule.Minify,
+		EscapeQuote: rule.EscapeQuote,
+		MultiLocale: rule.MultiLocale,
+		Precompress: encodings,
+		MinSavings:  conf.Options.MinSavings,
+		Fingerprint: rule.Fingerprint,
+		Rewrite:     rule.Rewrite,
+		Map:         rule.Map,
+	}
+}
+
+// logMinified reports what the built-in minifiers saved.
+func logMinified() {
+	totals := minify.Totals()
+	for _, name := range minify.Types() {
+		if s, ok := totals[name]; ok {
+			log.Printf("minify %s: %s\n", name, s)
+		}
 	}
-	os.MkdirAll(dir, 0755)   // Make sure it exists, so that RemoveAll won't fail
-	err := os.RemoveAll(dir) // Remove all - including old files, subdirs, etc.
+}
+
+// writeSitesYAML exports the site list.
+func writeSitesYAML(l *sites.List, fn string) {
+	text, err := l.YAML()
 	if err != nil {
 		log.Fatal(err)
 	}
-	err = os.MkdirAll(dir, 0755) // Make sure the directory now exists, for real.
+	err = ioutil.WriteFile(fn, []byte(text), 0644)
 	if err != nil {
 		log.Fatal(err)
 	}
 }
 
-func main() {
-	flag.Parse()
-	log.SetFlags(log.LstdFlags | log.Lshortfile)
+// writeDeps saves the include graph gathered while expanding templates.
+func writeDeps(p *project, fn string) {
+	b := &bytes.Buffer{}
+	p.parsed.WriteGraph(b)
+	err := ioutil.WriteFile(fn, b.Bytes(), 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
 
-	if *configHelp {
-		fmt.Println(config.Example())
-		os.Exit(0)
+// configCommand checks the config file, shows it, or prints the schema for it.
+func configCommand(cmd string, args []string) {
+	switch cmd {
+	case "validate":
+		_, err := config.Load(*configFileName, configSets...)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println("config OK")
+	case "show":
+		conf, sources, err := config.LoadSources(*configFileName, os.Environ(), configSets)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(args) > 0 && (args[0] == "--effective" || args[0] == "-effective") {
+			w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+			for _, row := range conf.Effective(sources) {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", row[0], row[2], row[1])
+			}
+			w.Flush()
+		} else {
+			fmt.Println(conf.String())
+		}
+	case "schema":
+		fmt.Print(config.Schema())
+	default:
+		log.Fatalf("usage: builder [--config file] [--set Path=value] config validate|show [--effective]|schema")
+	}
+}
+
+// rollback switches the output directory back to the previous build.
+func rollback() {
+	conf, err := config.Load(*configFileName, configSets...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	dir, err := output.Rollback(conf.Directories.OutputDir)
+	if err != nil {
+		log.Fatal(err)
 	}
-	conf, err := config.Load(*configFileName)
+	fmt.Printf("%s now points to %s\n", conf.Directories.OutputDir, dir)
+}
+
+// serveOutput previews the current build over HTTP.
+func serveOutput() {
+	conf, err := config.Load(*configFileName, configSets...)
 	if err != nil {
 		log.Fatal(err)
 	}
+	addr := *listenAddr
+	if addr == "" {
+		addr = "localhost:8080"
+	}
+	log.Fatal(serve.New(conf.Directories.OutputDir, false).ListenAndServe(addr))
+}
+
+// listFuncs shows the functions templates can call.
+func listFuncs() {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	for _, f := range tfuncs.List(&tfuncs.Options{}) {
+		fmt.Fprintf(w, "%s\t[%% %s %%]\t%s\n", f.Name, f.Usage, f.Help)
+	}
+	w.Flush()
+}
+
+// buildAll does a complete build for conf, and switches the output
+// directory over to it.
+func buildAll(conf *config.Record) (*project, *output.Build) {
+	started := time.Now()
+
+	// Hashed before the output directory becomes the staging one, so
+	// that the same config always hashes the same.
+	configHash := manifest.SHA256([]byte(conf.String()))
 
-	prepOutput(conf.Directories.OutputDir)
-
-	var postTable = []job.PostInfoType{
-		{
-			Directory:   "css",
-			Extension:   ".css",
-			PostProcess: conf.Processors.CSS,
-			EscapeQuote: false,
-			MultiLocale: false,
-			Compress:    true,
-		},
-		{
-			Directory:   "js",
-			Extension:   ".js",
-			PostProcess: conf.Processors.JS,
-			EscapeQuote: true,
-			MultiLocale: true,
-			Compress:    true,
-		},
-		{
-			Directory:   "html",
-			Extension:   ".html",
-			PostProcess: conf.Processors.HTML,
-			EscapeQuote: false,
-			MultiLocale: true,
-			Compress:    true,
-		},
-		{
-			Directory:   "php",
-			Extension:   ".php",
-			PostProcess: conf.Processors.PHP,
-			EscapeQuote: false,
-			MultiLocale: false,
-			Compress:    false,
-		},
-		{
-			Directory:   "apache",
-			Extension:   ".htaccess",
-			PostProcess: conf.Processors.Apache,
-			EscapeQuote: false,
-			MultiLocale: false,
-			Compress:    false,
-		},
-		{
-			Directory:   "apache",
-			Extension:   ".example",
-			PostProcess: conf.Processors.Apache,
-			EscapeQuote: false,
-			MultiLocale: false,
-			Compress:    false,
-		},
-	}
-
-	// Start the job queue for templates
-	jobTracker := job.StartQueue(conf.Options.MaxThreads)
-
-	// Load all langauges, calculate all percentages of completion.
-	languages, err := po.LoadAll(conf.Directories.PoDir+"/falling-sky.pot", conf.Directories.PoDir+"/dl")
+	// Build into a staging directory; the configured one is switched
+	// over to it at the very end, if all goes well.
+	build, err := output.Prepare(conf.Directories.OutputDir)
 	if err != nil {
 		log.Fatal(err)
 	}
-	languages.Pot.Language = "en_US"
+	log.Printf("building into %s\n", build.Dir)
+	conf.Directories.OutputDir = build.Dir
 
-	// Grab this just once.
-	cachedGitInfo := gitinfo.GetGitInfo()
+	// Load everything the templates need, then queue them all.
+	p := loadProject(conf)
+	p.manifest.Build.ConfigSHA256 = configHash
+	p.runJobs(nil)
+	hits, misses := p.cache.Stats()
+	log.Printf("%v templates copied from the cache, %v built\n", hits, misses)
+	logMinified()
 
-	for _, tt := range postTable {
-		inputDir := conf.Directories.TemplateDir + "/" + tt.Directory
-		files, err := fileutil.FilesInDirNotRecursive(inputDir)
-		if err != nil {
-			log.Fatal(err)
-		}
-		//	log.Printf("files: %#v\n", files)
-
-		rootDir := conf.Directories.TemplateDir + "/" + tt.Directory
-		addLanguages := languages.ApacheAddLanguage()
-		signature := signature.ScanDir(rootDir, addLanguages)
-
-		// Wrapper for launch jobs, gets all the variables into place and in scope
-		launcher := func(file string, locale string, pofile *po.File) {
-
-			// Build up what we need to know about the project, that
-			// the templates will ask about.
-			td := &job.TemplateData{
-				GitInfo:      cachedGitInfo,
-				PoMap:        languages.ByLanguage,
-				Locale:       pofile.GetLocale(),
-				Lang:         pofile.GetLang(),
-				LangUC:       pofile.GetLangUC(),
-				Basename:     strings.Split(file, ".")[0],
-				AddLanguage:  addLanguages,
-				DirSignature: signature,
-			}
+	if *depsFileName != "" {
+		writeDeps(p, *depsFileName)
+	}
 
-			job := &job.QueueItem{
-				Config:   conf,
-				RootDir:  rootDir,
-				Filename: file,
-				PoFile:   pofile,
-				Data:     td,
-				PostInfo: tt,
-			}
-			jobTracker.Add(job)
+	p.writeExtras()
+	p.writeManifest(started)
 
-		}
+	err = p.languages.NewPot.Save(conf.Directories.PoDir + "/falling-sky.newpot")
+	if err != nil {
+		log.Fatal(err)
+	}
 
-		// Start launching specific jobs
-		for _, file := range files {
-			if strings.HasSuffix(file, tt.Extension) {
-				//		log.Printf("file=%s\n", file)
-				launcher(file, "en_US", languages.NewPot)
-				if tt.MultiLocale {
-					for locale, pofile := range languages.ByLanguage {
-						launcher(file, locale, pofile)
-					}
-				}
-			}
-		}
+	err = build.Commit(*conf.Options.KeepBuilds)
+	if err != nil {
+		log.Fatal(err)
 	}
+	log.Printf("%s now points to %s\n", build.Live, build.Dir)
+	return p, build
+}
 
-	// Wait for all process jobs to finish
-	jobTracker.Wait()
+func main() {
+	flag.Parse()
+	log.SetFlags(log.LstdFlags | log.Lshortfile)
 
-	// Copy images
-	copyFiles(conf.Directories.ImagesDir, conf.Directories.OutputDir+"/images")
-	copyFiles(conf.Directories.ImagesDir, conf.Directories.OutputDir+"/images-nc")
-	copyFilesAll(conf.Directories.TransparentDir, conf.Directories.OutputDir+"/transparent")
+	if *profileName != "" {
+		configSets = append(configSets, "Profile="+*profileName)
+	}
 
-	// A couple last minute symlinks
-	os.Symlink(".", conf.Directories.OutputDir+"/isp")
-	os.Symlink(".", conf.Directories.OutputDir+"/helpdesk")
+	switch flag.Arg(0) {
+	case "":
+	case "funcs":
+		listFuncs()
+		os.Exit(0)
+	case "rollback":
+		rollback()
+		os.Exit(0)
+	case "watch":
+		watch()
+		os.Exit(0)
+	case "serve":
+		serveOutput()
+		os.Exit(0)
+	case "config":
+		args := []string{}
+		if flag.NArg() > 2 {
+			args = flag.Args()[2:]
+		}
+		configCommand(flag.Arg(1), args)
+		os.Exit(0)
+	default:
+		log.Fatalf("unknown command %q", flag.Arg(0))
+	}
 
-	err = languages.NewPot.Save(conf.Directories.PoDir + "/falling-sky.newpot")
+	if *configHelp {
+		fmt.Println(config.Example())
+		os.Exit(0)
+	}
+	conf, err := config.Load(*configFileName, configSets...)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	buildAll(conf)
 }
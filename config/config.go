@@ -3,10 +3,34 @@ package config
 import (
 	"bytes"
 	"encoding/json"
-	"io/ioutil"
+	"fmt"
 	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/falling-sky/builder/assets"
+	"github.com/falling-sky/builder/minify"
+	"github.com/falling-sky/builder/precompress"
+	"github.com/falling-sky/builder/process"
+	"github.com/falling-sky/builder/rewrite"
 )
 
+// Rule says how the templates in one directory are built.
+type Rule struct {
+	Directory   string            // Under TemplateDir
+	Files       []string          // Glob patterns for file names, such as "*.html"
+	Processor   string            // Which Processors list to run: JS, CSS, HTML, PHP, Apache; or empty
+	Minify      []minify.Step     // Built-in minifiers, run before the Processors list
+	EscapeQuote bool              // Escape quotes in translations (for JavaScript strings)
+	MultiLocale bool              // Build once per language, instead of just en_US
+	Compress    bool              // Also write a gzipped copy; the same as listing gzip in Precompress
+	Precompress []string          // Compressed copies to write: gzip, br, zstd
+	Fingerprint bool              // Also write copies with content-hashed names, for the asset function; built before other rules
+	Rewrite     []rewrite.Rule    // Edits to outputs as they are written, per variant (plain, gzip, ...)
+	Map         map[string]string // Output names for specific files; checked before the global Map
+}
+
 // Record contains configuration options
 type Record struct {
 	Directories struct {
@@ -15,19 +39,34 @@ type Record struct {
 		TransparentDir string
 		PoDir          string
 		OutputDir      string
+		SharedDirs     []string // Searched for PROCESS names after a directory's own root
+		OverrideDir    string   // Searched last; site specific snippets
+		DataDir        string   // JSON and YAML files, available to templates as .Data
+		SitesFile      string   // Canonical list of partner sites and mirrors
+		CacheDir       string   // Outputs of earlier builds, reused when inputs are unchanged
 	}
 	Processors struct {
 		Note   []string
-		JS     []string
-		CSS    []string
-		HTML   []string
-		PHP    []string
-		Apache []string
+		JS     []process.Step
+		CSS    []process.Step
+		HTML   []process.Step
+		PHP    []process.Step
+		Apache []process.Step
 	}
-	Map     map[string]string
-	Options struct {
-		MaxThreads int
+	Pipeline []Rule
+	Map      map[string]string
+	Vars     map[string]interface{} // Available to templates as .Vars
+	Options  struct {
+		MaxThreads      int
+		MaxIncludeDepth int     // How deeply PROCESS directives may nest
+		MinTranslated   int     // Percent translated a language needs to be built
+		NoCompress      bool    // Skip the compressed copies, whatever the pipeline says
+		KeepBuilds      *int    // Previous builds kept for "builder rollback"; 3 if unset, and 0 keeps none
+		TypeMaps        bool    // Write Apache type maps (index.html.var) instead of relying on MultiViews
+		MinSavings      float64 // Skip a compressed copy that saves less than this fraction, such as 0.05
 	}
+	Profile  string                            // Active profile; chosen with --profile
+	Profiles map[string]map[string]interface{} // Named overlays on this config; see ApplyProfile
 }
 
 // Defaults will update a config record with safe defaults for any missing values
@@ -47,48 +86,69 @@ func (r *Record) Defaults() {
 	if r.Directories.OutputDir == "" {
 		r.Directories.OutputDir = "output"
 	}
+	if r.Directories.CacheDir == "" {
+		r.Directories.CacheDir = filepath.Clean(r.Directories.OutputDir) + ".cache"
+	}
+	if r.Directories.DataDir == "" {
+		r.Directories.DataDir = r.Directories.TemplateDir + "/data"
+	}
+	if r.Directories.SitesFile == "" {
+		r.Directories.SitesFile = r.Directories.DataDir + "/sites.yaml"
+	}
 
 	if len(r.Processors.Note) == 0 {
 		r.Processors.Note = []string{
+			"Each step is {Processor: exec, Args: [command, arg, ...]}, which runs the command without a shell,",
+			"with the output on its standard input; what it prints becomes the new output.",
+			"{Processor: minify, Args: [js, safe, sourcemap]} runs a built-in minifier: html, css, js or json.",
+			"A plain string is a /bin/sh command line, as before: the output is written to [INPUT] first,",
+			"and the command must leave its result in [NAME].",
+			"Commands may also set ExitCodes (default [0]), Timeout (default 5m), Env, and Dir (relative to the output).",
+			"What they print to stderr (and stdout, for shell commands) goes in report.json in CacheDir.",
 			"Macros available:",
 			"[NAME] will simply be index.html.en_US, index.js.en_US, or comment.php",
 			"[NAMEGZ] will simply be index.html.gz.en_US, index.js.gz.en_US, or comment.php.gz",
-			"For convenience:",
-			"[INPUT] will be identical to [NAME].orig - and is written to disk at the start of the commands.",
-			"[OUTPUT] will be idetnical to [NAME]",
-			"All processors must be defined.  At minimum simply use mv [NAME].orig NAME",
+			"[INPUT] will be identical to [NAME].orig",
+			"[OUTPUT] will be identical to [NAME]",
 		}
 	}
 
 	if len(r.Processors.JS) == 0 {
-		r.Processors.JS = []string{
-		//			`uglifyjs2  [NAME].orig -o [NAME] -c --warnings=false   --source-map [NAME].map   --stats`,
-		//			`mv [NAME].orig [NAME]`,
-		//			`gzip -f -9 -Sgz  < [NAME]  > [NAMEGZ]`,
+		r.Processors.JS = []process.Step{
+			// {Processor: "exec", Args: []string{"uglifyjs", "-c", "--warnings=false"}},
 		}
 	}
 	if len(r.Processors.CSS) == 0 {
-		r.Processors.CSS = []string{
-		//			`cssmin < [NAME].orig > [NAME]`,
-		//			`mv [NAME].orig [NAME]`,
-		//			`gzip -f -9 -Sgz  < [NAME]  > [NAMEGZ]`,
+		r.Processors.CSS = []process.Step{
+			// {Processor: "exec", Args: []string{"cssmin"}},
 		}
 	}
 	if len(r.Processors.HTML) == 0 {
-		r.Processors.HTML = []string{
-		//		`tidy -quiet -indent -asxhtml -utf8 -w 120 --show-warnings false < [NAME].orig > [NAME]`,
-		//		`sed < [NAME] 's#/index.js#/index.js.gz#' | gzip -f -9 -Sgz  > [NAMEGZ]`,
+		r.Processors.HTML = []process.Step{
+			// {Processor: "exec", Args: []string{"tidy", "-quiet", "-indent", "-asxhtml", "-utf8", "-w", "120", "--show-warnings", "false"}, ExitCodes: []int{0, 1}},
 		}
 	}
 	if len(r.Processors.PHP) == 0 {
-		r.Processors.PHP = []string{
-		//			`mv [NAME].orig [NAME]`,
-		}
+		r.Processors.PHP = []process.Step{}
 	}
 	if len(r.Processors.Apache) == 0 {
-		r.Processors.Apache = []string{
-		//			`mv [NAME].orig [NAME]`,
-		}
+		r.Processors.Apache = []process.Step{}
+	}
+
+	if len(r.Pipeline) == 0 {
+		r.Pipeline = DefaultPipeline()
+	}
+
+	if r.Options.MaxIncludeDepth == 0 {
+		r.Options.MaxIncludeDepth = 16
+	}
+	if r.Options.KeepBuilds == nil {
+		keep := 3
+		r.Options.KeepBuilds = &keep
+	}
+
+	if r.Vars == nil {
+		r.Vars = make(map[string]interface{})
 	}
 
 	if r.Map == nil {
@@ -103,23 +163,217 @@ func (r *Record) Defaults() {
 
 }
 
-// Load a config file, return it after adjusting for defaults
-func Load(filename string) (*Record, error) {
-	r := &Record{}
+// DefaultPipeline is the built-in set of rules, used when the config has none.
+func DefaultPipeline() []Rule {
+	return []Rule{
+		{Directory: "css", Files: []string{"*.css"}, Processor: "CSS", Compress: true, Fingerprint: true},
+		{Directory: "js", Files: []string{"*.js"}, Processor: "JS", EscapeQuote: true, MultiLocale: true, Compress: true, Fingerprint: true},
+		{Directory: "html", Files: []string{"*.html"}, Processor: "HTML", MultiLocale: true, Compress: true, Rewrite: AssetRewrites()},
+		{Directory: "php", Files: []string{"*.php"}, Processor: "PHP"},
+		{Directory: "apache", Files: []string{"*.htaccess", "*.example"}, Processor: "Apache"},
+	}
+}
+
+// AssetRewrites points the gzipped copy of a page at the gzipped copies
+// of the fingerprinted scripts and stylesheets it names, such as
+// index.SUM.js.gz.fr_FR for index.SUM.js.fr_FR; see package assets.
+func AssetRewrites() []rewrite.Rule {
+	hashed := fmt.Sprintf(`/[^"]*\.[0-9a-f]{%d}`, assets.HashLength)
+	return []rewrite.Rule{
+		{From: `src="(` + hashed + `\.js)(\.\w+)?"`, To: `src="$1.gz$2"`, Regexp: true, Variants: []string{"gzip"}},
+		{From: `href="(` + hashed + `\.css)(\.\w+)?"`, To: `href="$1.gz$2"`, Regexp: true, Variants: []string{"gzip"}},
+	}
+}
 
-	// If a filename is specified, load it.
-	if filename != "" {
-		b, e := ioutil.ReadFile(filename)
-		if e != nil {
-			return r, e
+// Encodings returns the compressed copies a rule asks for, by encoder
+// name; see package precompress.
+func (rule *Rule) Encodings() []string {
+	names := []string{}
+	if rule.Compress {
+		names = append(names, "gzip")
+	}
+	for _, name := range rule.Precompress {
+		if name != "gzip" || !rule.Compress {
+			names = append(names, name)
 		}
-		e = json.Unmarshal(b, r)
-		if e != nil {
-			return r, e
+	}
+	return names
+}
+
+// Encodings returns every encoding the pipeline writes, unless
+// Options.NoCompress turns them off.
+func (r *Record) Encodings() []string {
+	names := []string{}
+	if r.Options.NoCompress {
+		return names
+	}
+	seen := make(map[string]bool)
+	for i := range r.Pipeline {
+		for _, name := range r.Pipeline[i].Encodings() {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
 		}
 	}
-	r.Defaults()
-	return r, nil
+	return names
+}
+
+// Variants names the copies of an output that rewrite rules can pick:
+// the plain one, then each encoding.
+func Variants() []string {
+	return append([]string{rewrite.Plain}, precompress.Names()...)
+}
+
+// ProcessorSteps returns the steps of a named Processors list.
+func (r *Record) ProcessorSteps(name string) ([]process.Step, bool) {
+	switch name {
+	case "":
+		return nil, true
+	case "JS":
+		return r.Processors.JS, true
+	case "CSS":
+		return r.Processors.CSS, true
+	case "HTML":
+		return r.Processors.HTML, true
+	case "PHP":
+		return r.Processors.PHP, true
+	case "Apache":
+		return r.Processors.Apache, true
+	}
+	return nil, false
+}
+
+// CheckPipeline makes sure every rule is usable, and that no two rules
+// could claim the same file.  Overlap between different patterns can
+// only be seen against real file names; see MatchRule.
+func (r *Record) CheckPipeline() error {
+	seen := make(map[string]int)
+	for i, rule := range r.Pipeline {
+		where := fmt.Sprintf("Pipeline[%d] (%s)", i, rule.Directory)
+		if rule.Directory == "" {
+			return fmt.Errorf("Pipeline[%d]: Directory is required", i)
+		}
+		if len(rule.Files) == 0 {
+			return fmt.Errorf("%s: Files is required", where)
+		}
+		if _, ok := r.ProcessorSteps(rule.Processor); !ok {
+			return fmt.Errorf("%s: unknown Processor %q (want JS, CSS, HTML, PHP, Apache, or empty)", where, rule.Processor)
+		}
+		for _, name := range rule.Precompress {
+			if _, ok := precompress.Get(name); !ok {
+				return fmt.Errorf("%s: unknown Precompress encoding %q (want one of %s)", where, name, strings.Join(precompress.Names(), ", "))
+			}
+		}
+		for j := range rule.Minify {
+			if err := rule.Minify[j].Check(); err != nil {
+				return fmt.Errorf("%s: Minify[%d]: %v (want one of %s)", where, j, err, strings.Join(minify.Types(), ", "))
+			}
+		}
+		for j := range rule.Rewrite {
+			rw := &rule.Rewrite[j]
+			if err := rw.Check(); err != nil {
+				return fmt.Errorf("%s: Rewrite[%d]: %v", where, j, err)
+			}
+			for _, v := range rw.Variants {
+				if _, ok := precompress.Get(v); !ok && v != rewrite.Plain {
+					return fmt.Errorf("%s: Rewrite[%d]: unknown variant %q (want %s)", where, j, v, strings.Join(Variants(), ", "))
+				}
+			}
+		}
+		for _, pattern := range rule.Files {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return fmt.Errorf("%s: bad pattern %q: %v", where, pattern, err)
+			}
+			if strings.Contains(pattern, "/") {
+				return fmt.Errorf("%s: pattern %q must match file names, not paths", where, pattern)
+			}
+			key := filepath.Clean(rule.Directory) + "/" + pattern
+			if j, ok := seen[key]; ok {
+				return fmt.Errorf("%s: %q is already handled by Pipeline[%d]", where, pattern, j)
+			}
+			seen[key] = i
+		}
+	}
+	return nil
+}
+
+// MatchRule finds the rule for file in directory dir.  It is an error for
+// more than one rule to match.
+func (r *Record) MatchRule(dir string, file string) (*Rule, error) {
+	var found *Rule
+	foundAt := 0
+	for i := range r.Pipeline {
+		rule := &r.Pipeline[i]
+		if filepath.Clean(rule.Directory) != filepath.Clean(dir) {
+			continue
+		}
+		for _, pattern := range rule.Files {
+			if ok, _ := filepath.Match(pattern, file); !ok {
+				continue
+			}
+			if found != nil && found != rule {
+				return nil, fmt.Errorf("%s/%s matches both Pipeline[%d] and Pipeline[%d]", dir, file, foundAt, i)
+			}
+			found, foundAt = rule, i
+		}
+	}
+	return found, nil
+}
+
+// PipelineDirs returns each directory named in the pipeline, once, in order.
+func (r *Record) PipelineDirs() []string {
+	dirs := []string{}
+	seen := make(map[string]bool)
+	for _, rule := range r.Pipeline {
+		dir := filepath.Clean(rule.Directory)
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// IncludePath returns the ordered list of directories searched when
+// resolving PROCESS names for templates under root: root itself, then
+// each of SharedDirs, then OverrideDir.
+func (r *Record) IncludePath(root string) []string {
+	dirs := append([]string{root}, r.Directories.SharedDirs...)
+	if r.Directories.OverrideDir != "" {
+		dirs = append(dirs, r.Directories.OverrideDir)
+	}
+	return dirs
+}
+
+// Load a config file, return it after adjusting for defaults.
+// Settings are applied in this order, later ones winning:
+//
+//  1. the config file: JSON, YAML or TOML, chosen by extension
+//  2. the active profile, and the profiles it extends
+//  3. BUILDER_* environment variables, such as BUILDER_DIRECTORIES_OUTPUTDIR
+//  4. overrides, "Directories.OutputDir=/srv/www", as given to -set
+//  5. defaults, for anything still empty
+//
+// The active profile is chosen by a "Profile=name" override (--profile),
+// then BUILDER_PROFILE, then the config file's Profile setting.
+func Load(filename string, overrides ...string) (*Record, error) {
+	r, _, e := LoadSources(filename, os.Environ(), overrides)
+	return r, e
+}
+
+// Decode unmarshals a JSON config into r.  Unlike json.Unmarshal, fields
+// that Record doesn't have are an error, so that typos are caught.
+func Decode(b []byte, r *Record) error {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.DisallowUnknownFields()
+	if e := d.Decode(r); e != nil {
+		return e
+	}
+	if d.More() {
+		return fmt.Errorf("unexpected data after the config object")
+	}
+	return nil
 }
 
 func (r *Record) String() string {
@@ -0,0 +1,119 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/falling-sky/builder/process"
+	"github.com/falling-sky/builder/rewrite"
+)
+
+func TestCheckPipeline(t *testing.T) {
+	var table = []struct {
+		rules []Rule
+		want  string
+	}{
+		{DefaultPipeline(), ""},
+		{[]Rule{{Files: []string{"*.json"}}}, "Directory is required"},
+		{[]Rule{{Directory: "json"}}, "Files is required"},
+		{[]Rule{{Directory: "json", Files: []string{"*.json"}, Processor: "XML"}}, `unknown Processor "XML"`},
+		{[]Rule{{Directory: "json", Files: []string{"[*.json"}}}, "bad pattern"},
+		{[]Rule{{Directory: "json", Files: []string{"a/*.json"}}}, "file names, not paths"},
+		{[]Rule{
+			{Directory: "txt", Files: []string{"*.txt"}},
+			{Directory: "txt/", Files: []string{"*.txt"}},
+		}, `Pipeline[1] (txt/): "*.txt" is already handled by Pipeline[0]`},
+	}
+	for i, tt := range table {
+		r := &Record{Pipeline: tt.rules}
+		err := r.CheckPipeline()
+		switch {
+		case tt.want == "" && err != nil:
+			t.Errorf("%d: unexpected error %v", i, err)
+		case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+			t.Errorf("%d: got %v, want error containing %q", i, err, tt.want)
+		}
+	}
+}
+
+func TestMatchRule(t *testing.T) {
+	r := &Record{}
+	r.Defaults()
+	rule, err := r.MatchRule("apache", "dot.htaccess")
+	if err != nil || rule == nil || rule.Processor != "Apache" {
+		t.Errorf("dot.htaccess: got %v, %v", rule, err)
+	}
+	if rule, _ := r.MatchRule("html", "notes.txt"); rule != nil {
+		t.Errorf("notes.txt: got %v, want no rule", rule)
+	}
+
+	r.Pipeline = append(r.Pipeline, Rule{Directory: "html", Files: []string{"index.*"}})
+	if _, err := r.MatchRule("html", "index.html"); err == nil || !strings.Contains(err.Error(), "matches both Pipeline[2] and Pipeline[5]") {
+		t.Errorf("overlap: got %v", err)
+	}
+}
+
+func TestDecodeUnknownField(t *testing.T) {
+	r := &Record{}
+	err := Decode([]byte(`{"Directories": {"OutptDir": "/tmp/x"}}`), r)
+	if err == nil || !strings.Contains(err.Error(), `unknown field "OutptDir"`) {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, d := range []string{"templates/data", "images", "transparent", "translations"} {
+		os.MkdirAll(filepath.Join(dir, d), 0755)
+	}
+	ioutil.WriteFile(filepath.Join(dir, "templates/data/sites.yaml"), nil, 0644)
+
+	base := func() *Record {
+		r := &Record{}
+		r.Directories.TemplateDir = dir + "/templates"
+		r.Directories.ImagesDir = dir + "/images"
+		r.Directories.TransparentDir = dir + "/transparent"
+		r.Directories.PoDir = dir + "/translations"
+		r.Directories.OutputDir = dir + "/output"
+		r.Defaults()
+		return r
+	}
+	if err := base().Validate(); err != nil {
+		t.Fatalf("good config: %v", err)
+	}
+
+	var table = []struct {
+		change func(r *Record)
+		want   string
+	}{
+		{func(r *Record) { r.Directories.OutputDir = "/" }, "refusing to use /"},
+		{func(r *Record) { r.Directories.OutputDir = dir + "/templates/out" }, "is inside TemplateDir"},
+		{func(r *Record) { r.Directories.OutputDir = dir }, "holds ImagesDir"},
+		{func(r *Record) { r.Directories.ImagesDir = dir + "/nope" }, "Directories.ImagesDir: stat"},
+		{func(r *Record) { r.Directories.SharedDirs = []string{dir + "/nope"} }, "Directories.SharedDirs[0]"},
+		{func(r *Record) {
+			r.Processors.HTML = []process.Step{{Processor: "shell", Args: []string{"tidy < [INPUT] > [OUTPT]"}}}
+		}, "Processors.HTML[0]: unknown macro [OUTPT]"},
+		{func(r *Record) { r.Processors.JS = []process.Step{{Processor: "uglify"}} }, `Processors.JS[0]: unknown processor "uglify"`},
+		{func(r *Record) { r.Processors.CSS = []process.Step{{Processor: "exec"}} }, "Processors.CSS[0]: exec needs a command"},
+		{func(r *Record) { r.Options.MaxThreads = -1 }, "Options.MaxThreads: -1 is out of range"},
+		{func(r *Record) { r.Pipeline[0].Processor = "Less" }, `unknown Processor "Less"`},
+		{func(r *Record) { r.Pipeline[2].Rewrite[0].Variants = []string{"gz"} }, `Rewrite[0]: unknown variant "gz"`},
+		{func(r *Record) { r.Pipeline[2].Rewrite[1] = rewrite.Rule{From: "(", Regexp: true} }, "Rewrite[1]: error parsing regexp"},
+	}
+	for i, tt := range table {
+		r := base()
+		tt.change(r)
+		err := r.Validate()
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%d: got %v, want error containing %q", i, err, tt.want)
+		}
+	}
+}
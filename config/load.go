@@ -0,0 +1,264 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/falling-sky/builder/data"
+	"gopkg.in/yaml.v2"
+)
+
+// EnvPrefix starts the names of environment variables that override
+// config settings.  The rest of the name is the setting's path, with
+// underscores for dots, in any case: BUILDER_OPTIONS_MAXTHREADS.
+const EnvPrefix = "BUILDER_"
+
+// Sources records where each setting's value came from: "file NAME",
+// "profile NAME", "env NAME", "flag -set", or "default".  Settings left at their zero
+// value have no entry.  Keys are dotted paths, like "Options.MaxThreads".
+type Sources map[string]string
+
+// LoadSources does the work for Load.  env is in os.Environ form, and
+// overrides are "Path=value" pairs.  Besides the config, it returns
+// where each value came from, for "builder config show --effective".
+func LoadSources(filename string, env []string, overrides []string) (*Record, Sources, error) {
+	r := &Record{}
+	sources := make(Sources)
+	mark := func(before map[string]string, source string) {
+		for path, v := range flatten(r) {
+			if before[path] != v {
+				sources[path] = source
+			}
+		}
+	}
+
+	// If a filename is specified, load it.
+	if filename != "" {
+		b, e := ioutil.ReadFile(filename)
+		if e != nil {
+			return r, sources, e
+		}
+		before := flatten(r)
+		e = decodeFile(filename, b, r)
+		if e != nil {
+			return r, sources, fmt.Errorf("%s: %v", filename, e)
+		}
+		mark(before, "file "+filename)
+	}
+
+	// Then the profile, if any.  The command line and the environment
+	// win over the config file when choosing it.
+	profile := r.Profile
+	for _, kv := range env {
+		if k, v := splitSetting(kv); strings.EqualFold(k, EnvPrefix+"PROFILE") {
+			profile = v
+		}
+	}
+	for _, o := range overrides {
+		if k, v := splitSetting(o); strings.EqualFold(k, "Profile") {
+			profile = v
+		}
+	}
+	chain, e := r.ProfileChain(profile)
+	if e != nil {
+		return r, sources, e
+	}
+	for _, name := range chain {
+		before := flatten(r)
+		if e := r.ApplyProfile(name); e != nil {
+			return r, sources, e
+		}
+		mark(before, "profile "+name)
+	}
+
+	// Then the environment.  Sorted, so errors are repeatable.
+	vars := append([]string{}, env...)
+	sort.Strings(vars)
+	for _, kv := range vars {
+		if !strings.HasPrefix(kv, EnvPrefix) {
+			continue
+		}
+		eq := strings.Index(kv, "=")
+		if eq < 0 {
+			continue
+		}
+		name, value := kv[:eq], kv[eq+1:]
+		path := strings.Split(strings.TrimPrefix(name, EnvPrefix), "_")
+		canon, e := setPath(r, path, value)
+		if e != nil {
+			return r, sources, fmt.Errorf("environment %s: %v", name, e)
+		}
+		sources[canon] = "env " + name
+	}
+
+	// Then the command line.
+	for _, o := range overrides {
+		eq := strings.Index(o, "=")
+		if eq < 0 {
+			return r, sources, fmt.Errorf("-set %q: want Path=value", o)
+		}
+		canon, e := setPath(r, strings.Split(o[:eq], "."), o[eq+1:])
+		if e != nil {
+			return r, sources, fmt.Errorf("-set %q: %v", o, e)
+		}
+		sources[canon] = "flag -set"
+	}
+
+	before := flatten(r)
+	r.Defaults()
+	mark(before, "default")
+
+	if e := r.Validate(); e != nil {
+		return r, sources, e
+	}
+	return r, sources, nil
+}
+
+// splitSetting splits "name=value".
+func splitSetting(s string) (string, string) {
+	eq := strings.Index(s, "=")
+	if eq < 0 {
+		return s, ""
+	}
+	return s[:eq], s[eq+1:]
+}
+
+// decodeFile decodes a config file, choosing the format by extension.
+// YAML and TOML are converted to JSON first, so that every format uses
+// the same field names and is just as strict about unknown fields.
+func decodeFile(filename string, b []byte, r *Record) error {
+	var v interface{}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+		return Decode(b, r)
+	case ".yaml", ".yml":
+		if e := yaml.Unmarshal(b, &v); e != nil {
+			return e
+		}
+		n, e := data.Normalize(v)
+		if e != nil {
+			return e
+		}
+		v = n
+	case ".toml":
+		m := make(map[string]interface{})
+		if _, e := toml.Decode(string(b), &m); e != nil {
+			return e
+		}
+		v = m
+	default:
+		return fmt.Errorf("unknown config file type %q (want .json, .yaml, .yml or .toml)", filepath.Ext(filename))
+	}
+	j, e := json.Marshal(v)
+	if e != nil {
+		return e
+	}
+	return Decode(j, r)
+}
+
+// setPath sets the field named by path (matched without regard to case)
+// from text.  Strings are used as-is, numbers and booleans parsed, and
+// lists and maps must be JSON.  It returns the field's proper path.
+func setPath(r *Record, path []string, text string) (string, error) {
+	v := reflect.ValueOf(r).Elem()
+	canon := []string{}
+	for _, name := range path {
+		if v.Kind() != reflect.Struct {
+			return "", fmt.Errorf("%s has no field %s", strings.Join(canon, "."), name)
+		}
+		f, ok := v.Type().FieldByNameFunc(func(n string) bool {
+			return strings.EqualFold(n, name)
+		})
+		if !ok {
+			if len(canon) == 0 {
+				return "", fmt.Errorf("unknown setting %s", name)
+			}
+			return "", fmt.Errorf("unknown setting %s in %s", name, strings.Join(canon, "."))
+		}
+		canon = append(canon, f.Name)
+		v = v.FieldByIndex(f.Index)
+	}
+	where := strings.Join(canon, ".")
+	if v.Kind() == reflect.Ptr {
+		v.Set(reflect.New(v.Type().Elem()))
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(text)
+	case reflect.Int:
+		n, e := strconv.Atoi(text)
+		if e != nil {
+			return "", fmt.Errorf("%s wants a number, not %q", where, text)
+		}
+		v.SetInt(int64(n))
+	case reflect.Bool:
+		b, e := strconv.ParseBool(text)
+		if e != nil {
+			return "", fmt.Errorf("%s wants true or false, not %q", where, text)
+		}
+		v.SetBool(b)
+	case reflect.Struct:
+		return "", fmt.Errorf("%s is a section; set the fields inside it", where)
+	default:
+		p := reflect.New(v.Type())
+		d := json.NewDecoder(strings.NewReader(text))
+		d.DisallowUnknownFields()
+		if e := d.Decode(p.Interface()); e != nil {
+			return "", fmt.Errorf("%s wants JSON: %v", where, e)
+		}
+		v.Set(p.Elem())
+	}
+	return where, nil
+}
+
+// flatten renders every setting as JSON, keyed by its dotted path.
+// Lists and maps count as single settings.
+func flatten(r *Record) map[string]string {
+	m := make(map[string]string)
+	var walk func(v reflect.Value, path string)
+	walk = func(v reflect.Value, path string) {
+		if v.Kind() == reflect.Struct {
+			for i := 0; i < v.NumField(); i++ {
+				walk(v.Field(i), join(path, v.Type().Field(i).Name))
+			}
+			return
+		}
+		if v.IsZero() {
+			return
+		}
+		b, _ := json.Marshal(v.Interface())
+		m[path] = string(b)
+	}
+	walk(reflect.ValueOf(r).Elem(), "")
+	return m
+}
+
+// Effective lists every non-empty setting as path, value (as JSON) and
+// source, in the order Record declares them.
+func (r *Record) Effective(sources Sources) [][3]string {
+	flat := flatten(r)
+	rows := [][3]string{}
+	var walk func(t reflect.Type, path string)
+	walk = func(t reflect.Type, path string) {
+		if t.Kind() == reflect.Struct {
+			for i := 0; i < t.NumField(); i++ {
+				walk(t.Field(i).Type, join(path, t.Field(i).Name))
+			}
+			return
+		}
+		if v, ok := flat[path]; ok {
+			rows = append(rows, [3]string{path, v, sources[path]})
+		}
+	}
+	walk(reflect.TypeOf(*r), "")
+	return rows
+}
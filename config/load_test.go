@@ -0,0 +1,175 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// inputTree makes the directories a default config needs, and returns
+// a config file body pointing at them.
+func inputTree(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "load_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range []string{"templates/data", "images", "transparent", "translations"} {
+		os.MkdirAll(filepath.Join(dir, d), 0755)
+	}
+	ioutil.WriteFile(filepath.Join(dir, "templates/data/sites.yaml"), nil, 0644)
+	return dir
+}
+
+func TestLoadFormats(t *testing.T) {
+	dir := inputTree(t)
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"c.json": `{"Directories": {"TemplateDir": "` + dir + `/templates", "ImagesDir": "` + dir + `/images", "TransparentDir": "` + dir + `/transparent", "PoDir": "` + dir + `/translations", "OutputDir": "` + dir + `/out"}, "Options": {"MaxThreads": 3}}`,
+		"c.yaml": "# Comments are fine here.\nDirectories:\n  TemplateDir: " + dir + "/templates\n  ImagesDir: " + dir + "/images\n  TransparentDir: " + dir + "/transparent\n  PoDir: " + dir + "/translations\n  OutputDir: " + dir + "/out\nOptions:\n  MaxThreads: 3\n",
+		"c.toml": "# And here.\n[Directories]\nTemplateDir = \"" + dir + "/templates\"\nImagesDir = \"" + dir + "/images\"\nTransparentDir = \"" + dir + "/transparent\"\nPoDir = \"" + dir + "/translations\"\nOutputDir = \"" + dir + "/out\"\n[Options]\nMaxThreads = 3\n",
+	}
+	for name, body := range files {
+		fn := filepath.Join(dir, name)
+		ioutil.WriteFile(fn, []byte(body), 0644)
+		r, sources, err := LoadSources(fn, nil, nil)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if r.Options.MaxThreads != 3 || r.Directories.OutputDir != dir+"/out" {
+			t.Errorf("%s: got %+v", name, r.Options)
+		}
+		if got := sources["Options.MaxThreads"]; got != "file "+fn {
+			t.Errorf("%s: MaxThreads source %q", name, got)
+		}
+		if got := sources["Options.MaxIncludeDepth"]; got != "default" {
+			t.Errorf("%s: MaxIncludeDepth source %q", name, got)
+		}
+		if *r.Options.KeepBuilds != 3 {
+			t.Errorf("%s: KeepBuilds defaulted to %v", name, *r.Options.KeepBuilds)
+		}
+	}
+
+	fn := filepath.Join(dir, "typo.yaml")
+	ioutil.WriteFile(fn, []byte("Directories:\n  OutptDir: /tmp/x\n"), 0644)
+	if _, _, err := LoadSources(fn, nil, nil); err == nil || !strings.Contains(err.Error(), `unknown field "OutptDir"`) {
+		t.Errorf("typo.yaml: got %v", err)
+	}
+}
+
+func TestLoadOverrides(t *testing.T) {
+	dir := inputTree(t)
+	defer os.RemoveAll(dir)
+	fn := filepath.Join(dir, "c.yaml")
+	ioutil.WriteFile(fn, []byte("Directories:\n  TemplateDir: "+dir+"/templates\n  ImagesDir: "+dir+"/images\n  TransparentDir: "+dir+"/transparent\n  PoDir: "+dir+"/translations\n  OutputDir: "+dir+"/out\nOptions:\n  MaxThreads: 3\n"), 0644)
+
+	env := []string{
+		"HOME=/nowhere",
+		"BUILDER_OPTIONS_MAXTHREADS=5",
+		"BUILDER_DIRECTORIES_OUTPUTDIR=" + dir + "/env-out",
+		"BUILDER_VARS={\"site\": \"test\"}",
+	}
+	sets := []string{"options.maxthreads=7", "Options.KeepBuilds=0"}
+	r, sources, err := LoadSources(fn, env, sets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Options.MaxThreads != 7 || *r.Options.KeepBuilds != 0 || r.Directories.OutputDir != dir+"/env-out" || r.Vars["site"] != "test" {
+		t.Errorf("got %+v %+v %v", r.Options, r.Directories, r.Vars)
+	}
+	want := map[string]string{
+		"Options.MaxThreads":    "flag -set",
+		"Options.KeepBuilds":    "flag -set",
+		"Directories.OutputDir": "env BUILDER_DIRECTORIES_OUTPUTDIR",
+		"Directories.PoDir":     "file " + fn,
+		"Vars":                  "env BUILDER_VARS",
+	}
+	for path, source := range want {
+		if sources[path] != source {
+			t.Errorf("%s: source %q, want %q", path, sources[path], source)
+		}
+	}
+
+	var bad = []struct {
+		env  []string
+		sets []string
+		want string
+	}{
+		{[]string{"BUILDER_OPTIONS_MAXTHREDS=1"}, nil, "unknown setting MAXTHREDS in Options"},
+		{[]string{"BUILDER_OPTIONS_MAXTHREADS=lots"}, nil, "Options.MaxThreads wants a number"},
+		{nil, []string{"Directories=x"}, "is a section"},
+		{nil, []string{"Options.MaxThreads"}, "want Path=value"},
+	}
+	for _, tt := range bad {
+		if _, _, err := LoadSources(fn, tt.env, tt.sets); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%v %v: got %v, want %q", tt.env, tt.sets, err, tt.want)
+		}
+	}
+}
+
+func TestLoadProfiles(t *testing.T) {
+	dir := inputTree(t)
+	defer os.RemoveAll(dir)
+	fn := filepath.Join(dir, "c.yaml")
+	ioutil.WriteFile(fn, []byte(`Directories:
+  TemplateDir: `+dir+`/templates
+  ImagesDir: `+dir+`/images
+  TransparentDir: `+dir+`/transparent
+  PoDir: `+dir+`/translations
+  OutputDir: `+dir+`/out
+Vars:
+  site: test-ipv6.com
+  debug: false
+Profiles:
+  production:
+    Options:
+      MinTranslated: 50
+  beta:
+    Extends: production
+    Directories:
+      OutputDir: `+dir+`/beta
+  dev:
+    Extends: beta
+    Options:
+      NoCompress: true
+    Vars:
+      debug: true
+  loop:
+    Extends: loop
+`), 0644)
+
+	if _, _, err := LoadSources(fn, nil, nil); err == nil || !strings.Contains(err.Error(), `profile "loop" extends itself`) {
+		t.Fatalf("loop: got %v", err)
+	}
+	b, _ := ioutil.ReadFile(fn)
+	ioutil.WriteFile(fn, []byte(strings.Replace(string(b), "  loop:\n    Extends: loop\n", "", 1)), 0644)
+
+	r, sources, err := LoadSources(fn, nil, []string{"Profile=dev"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Profile != "dev" || r.Directories.OutputDir != dir+"/beta" || r.Options.MinTranslated != 50 || !r.Options.NoCompress {
+		t.Errorf("dev: got %+v %+v", r.Directories, r.Options)
+	}
+	if r.Vars["debug"] != true || r.Vars["site"] != "test-ipv6.com" {
+		t.Errorf("dev: Vars should merge, got %v", r.Vars)
+	}
+	if got := sources["Directories.OutputDir"]; got != "profile beta" {
+		t.Errorf("OutputDir source %q", got)
+	}
+
+	// The environment chooses when the command line doesn't.
+	r, _, err = LoadSources(fn, []string{"BUILDER_PROFILE=production"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Directories.OutputDir != dir+"/out" || r.Options.MinTranslated != 50 || r.Options.NoCompress {
+		t.Errorf("production: got %+v %+v", r.Directories, r.Options)
+	}
+	if _, _, err := LoadSources(fn, nil, []string{"Profile=staging"}); err == nil || !strings.Contains(err.Error(), `unknown profile "staging" (have beta, dev, production)`) {
+		t.Errorf("staging: got %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ExtendsKey names the profile a profile starts from.  Without it, a
+// profile starts from the base config.
+const ExtendsKey = "Extends"
+
+// ProfileChain lists the profiles to apply for name, base-most first.
+func (r *Record) ProfileChain(name string) ([]string, error) {
+	chain := []string{}
+	seen := make(map[string]bool)
+	for name != "" {
+		p, ok := r.Profiles[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown profile %q (have %s)", name, strings.Join(r.ProfileNames(), ", "))
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("profile %q extends itself: %s -> %s", name, strings.Join(chain, " -> "), name)
+		}
+		seen[name] = true
+		chain = append(chain, name)
+
+		parent, _ := p[ExtendsKey].(string)
+		if _, ok := p[ExtendsKey]; ok && parent == "" {
+			return nil, fmt.Errorf("profile %q: %s must name a profile", name, ExtendsKey)
+		}
+		name = parent
+	}
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+	return chain, nil
+}
+
+// ProfileNames returns the names of the configured profiles, sorted.
+func (r *Record) ProfileNames() []string {
+	names := []string{}
+	for name := range r.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ApplyProfile overlays one profile on r.  A profile holds the same
+// settings as the config file itself: sections and maps (like Vars)
+// are merged, while lists (like Processors.HTML) are replaced.
+func (r *Record) ApplyProfile(name string) error {
+	overlay := make(map[string]interface{})
+	for k, v := range r.Profiles[name] {
+		switch k {
+		case ExtendsKey:
+		case "Profile", "Profiles":
+			return fmt.Errorf("profile %q: %s can't be set from a profile", name, k)
+		default:
+			overlay[k] = v
+		}
+	}
+	b, err := json.Marshal(overlay)
+	if err != nil {
+		return fmt.Errorf("profile %q: %v", name, err)
+	}
+	if err := Decode(b, r); err != nil {
+		return fmt.Errorf("profile %q: %v", name, err)
+	}
+	return nil
+}
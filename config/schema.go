@@ -0,0 +1,199 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+
+	"github.com/falling-sky/builder/minify"
+	"github.com/falling-sky/builder/precompress"
+	"github.com/falling-sky/builder/process"
+)
+
+// SchemaID names the schema; editors only use it as a label.
+const SchemaID = "https://github.com/falling-sky/builder/config/schema.json"
+
+// stepPath is where processor steps are described, whichever list
+// they are in.
+const stepPath = "Processors.Step"
+
+// descriptions documents config fields in the schema, keyed by their
+// dotted path.  Slice elements don't add to the path.
+var descriptions = map[string]string{
+	"Directories":                "Where inputs are read from, and output is written to.",
+	"Directories.TemplateDir":    "Templates; each pipeline directory is below this.",
+	"Directories.ImagesDir":      "Images, copied to images/ and images-nc/.",
+	"Directories.TransparentDir": "Copied to transparent/ as-is.",
+	"Directories.PoDir":          "Translations; falling-sky.pot and dl/*.po.",
+	"Directories.OutputDir":      "Becomes a symlink to the latest build, kept in OutputDir.builds. Must not be / or hold any input.",
+	"Directories.SharedDirs":     "Searched for PROCESS names after a directory's own root.",
+	"Directories.OverrideDir":    "Searched last for PROCESS names; site specific snippets.",
+	"Directories.DataDir":        "JSON and YAML files, available to templates as .Data.",
+	"Directories.SitesFile":      "Canonical list of partner sites and mirrors.",
+	"Directories.CacheDir":       "Outputs of earlier builds, reused when a template's inputs are unchanged. Safe to delete.",
+	"Processors":                 "Steps run on each output, by type. Macros in their arguments: [NAME] [NAMEGZ] [INPUT] [OUTPUT].",
+	"Processors.Step":            "A /bin/sh command line (the output is written to [INPUT], and the result left in [NAME]); or a named processor.",
+	"Processors.Step.Processor":  "exec runs Args[0] without a shell, output on its standard input and result on its standard output. minify runs a built-in minifier: Args are html, css, js or json, then safe or sourcemap.",
+	"Processors.Step.Args":       "The command and its arguments, for exec; options for the others.",
+	"Processors.Step.ExitCodes":  "Exit statuses that count as success, such as [0, 1] for tidy's warnings. Just 0 if empty.",
+	"Processors.Step.Timeout":    "How long the command may run before it is killed and its job fails, such as 30s. Five minutes if empty.",
+	"Processors.Step.Env":        "Environment variables added for the command. Macros are replaced in the values.",
+	"Processors.Step.Dir":        "Working directory for the command, relative to the output directory. Macros then become full paths.",
+	"Processors.Note":            "Free text; ignored. YAML and TOML configs can use comments instead.",
+	"Pipeline":                   "How each template directory is built. Defaults to the built-in table.",
+	"Pipeline.Directory":         "Directory under TemplateDir.",
+	"Pipeline.Files":             "Glob patterns for file names, such as *.html.",
+	"Pipeline.Processor":         "Which Processors list to run: JS, CSS, HTML, PHP, Apache; or empty.",
+	"Pipeline.Minify":            "Built-in minifiers, run in order before the Processors list, so that external tools are optional.",
+	"Pipeline.Minify.Type":       "Which minifier: html, css, js or json.",
+	"Pipeline.Minify.Safe":       "Leave <pre>, conditional comments, whitespace between tags, license comments and line breaks alone.",
+	"Pipeline.Minify.SourceMap":  "For js: write NAME.map next to the output, and point the output at it.",
+	"Pipeline.EscapeQuote":       "Escape quotes in translations (for JavaScript strings).",
+	"Pipeline.MultiLocale":       "Build once per language, instead of just en_US.",
+	"Pipeline.Compress":          "Also write a gzipped copy; the same as listing gzip in Precompress.",
+	"Pipeline.Precompress":       "Compressed copies to write, for servers to send as they are: gzip, br, zstd.",
+	"Pipeline.Fingerprint":       "Also write copies with content-hashed names, found with the asset template function. These rules are built before the others.",
+	"Pipeline.Rewrite":           "Edits to outputs as they are written, in order; each may apply to only some variants.",
+	"Pipeline.Rewrite.From":      "Text to find; a regular expression if Regexp is set.",
+	"Pipeline.Rewrite.To":        "Replacement; with Regexp, $1 and so on are submatches.",
+	"Pipeline.Rewrite.Regexp":    "From is a regular expression (Go syntax).",
+	"Pipeline.Rewrite.Variants":  "Which copies to change: plain, or an encoding such as gzip. Empty for all of them.",
+	"Pipeline.Map":               "Output names for specific files; checked before the global Map.",
+	"Map":                        "Output names for specific template files.",
+	"Vars":                       "Anything; available to templates as .Vars.",
+	"Options.MaxThreads":         "Template workers; 0 picks automatically.",
+	"Options.MaxIncludeDepth":    "How deeply PROCESS directives may nest.",
+	"Options.MinTranslated":      "Percent translated a language needs to be built.",
+	"Options.NoCompress":         "Skip the compressed copies, whatever the pipeline says.",
+	"Options.KeepBuilds":         "Previous builds kept next to OutputDir, for builder rollback. 0 keeps none.",
+	"Options.MinSavings":         "Skip a compressed copy that saves less than this fraction of the size, such as 0.05.",
+	"Options.TypeMaps":           "Write an Apache type map (name.var) for each multi-locale output, and negotiate with those instead of MultiViews.",
+	"Profile":                    "Active profile; usually chosen with --profile instead.",
+	"Profiles":                   "Named overlays holding any of these settings, plus Extends to start from another profile.",
+}
+
+// Schema returns a JSON Schema describing the config file, for editors.
+func Schema() string {
+	defaults := &Record{}
+	defaults.Defaults()
+
+	s := schemaFor(reflect.TypeOf(Record{}), reflect.ValueOf(*defaults), "")
+	s["$schema"] = "http://json-schema.org/draft-07/schema#"
+	s["$id"] = SchemaID
+	s["title"] = "builder config"
+
+	b := &bytes.Buffer{}
+	enc := json.NewEncoder(b)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(s); err != nil {
+		panic(err) // Only maps, strings and bools; can't fail.
+	}
+	return b.String()
+}
+
+// schemaFor describes type t.  def holds the default value, if any, and
+// path is where t sits in the config, for looking up descriptions.
+func schemaFor(t reflect.Type, def reflect.Value, path string) map[string]interface{} {
+	// Processor steps may also be plain shell commands.
+	if t == reflect.TypeOf(process.Step{}) && path != stepPath {
+		named := schemaFor(t, reflect.Value{}, stepPath)
+		delete(named, "description")
+		named["required"] = []string{"Processor"}
+		return map[string]interface{}{
+			"description": descriptions[stepPath],
+			"oneOf":       []interface{}{map[string]interface{}{"type": "string"}, named},
+		}
+	}
+
+	// Pointers are for settings where zero isn't the same as unset.
+	if t.Kind() == reflect.Ptr {
+		if def.IsValid() && !def.IsNil() {
+			def = def.Elem()
+		} else {
+			def = reflect.Value{}
+		}
+		return schemaFor(t.Elem(), def, path)
+	}
+
+	s := make(map[string]interface{})
+	if d, ok := descriptions[path]; ok {
+		s["description"] = d
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		s["type"] = "object"
+		s["additionalProperties"] = false
+		props := make(map[string]interface{})
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			var fd reflect.Value
+			if def.IsValid() {
+				fd = def.Field(i)
+			}
+			props[f.Name] = schemaFor(f.Type, fd, join(path, f.Name))
+		}
+		s["properties"] = props
+	case reflect.Slice:
+		s["type"] = "array"
+		items := schemaFor(t.Elem(), reflect.Value{}, path)
+		delete(items, "description")
+		s["items"] = items
+	case reflect.Map:
+		s["type"] = "object"
+		s["additionalProperties"] = schemaFor(t.Elem(), reflect.Value{}, "")
+	case reflect.String:
+		s["type"] = "string"
+	case reflect.Int:
+		s["type"] = "integer"
+		s["minimum"] = 0
+	case reflect.Float64:
+		s["type"] = "number"
+		s["minimum"] = 0
+	case reflect.Bool:
+		s["type"] = "boolean"
+	}
+
+	// Scalar defaults are worth showing; lists and maps are too long.
+	if def.IsValid() {
+		switch t.Kind() {
+		case reflect.String, reflect.Int, reflect.Bool:
+			if !def.IsZero() {
+				s["default"] = def.Interface()
+			}
+		}
+	}
+	if path == "Options.MaxThreads" {
+		s["maximum"] = MaxThreadsLimit
+	}
+	if path == "Options.MinTranslated" {
+		s["maximum"] = 100
+	}
+	if path == "Options.MinSavings" {
+		s["exclusiveMaximum"] = 1
+	}
+	if path == "Pipeline.Processor" {
+		s["enum"] = []string{"", "JS", "CSS", "HTML", "PHP", "Apache"}
+	}
+	if path == "Pipeline.Precompress" && t.Kind() == reflect.String {
+		s["enum"] = precompress.Names()
+	}
+	if path == stepPath+".Processor" {
+		s["enum"] = process.Names()
+	}
+	if path == "Pipeline.Minify.Type" {
+		s["enum"] = minify.Types()
+	}
+	if path == "Pipeline.Rewrite.Variants" && t.Kind() == reflect.String {
+		s["enum"] = Variants()
+	}
+	return s
+}
+
+func join(path string, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
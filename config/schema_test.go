@@ -0,0 +1,23 @@
+package config
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+)
+
+// schema.json is checked in for editors to use; it must match the code.
+// Regenerate it with:  builder config schema > config/schema.json
+func TestSchemaUpToDate(t *testing.T) {
+	b, err := ioutil.ReadFile("schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != Schema() {
+		t.Error("schema.json is out of date; run: builder config schema > config/schema.json")
+	}
+	var v map[string]interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,173 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/falling-sky/builder/fileutil"
+	"github.com/falling-sky/builder/process"
+)
+
+// MaxThreadsLimit is the most worker goroutines a config may ask for.
+const MaxThreadsLimit = 256
+
+// dirCheck is a directory Validate expects to find.
+type dirCheck struct {
+	name     string
+	path     string
+	optional bool
+}
+
+// Validate checks a (defaulted) config for mistakes that would otherwise
+// only show up part way through a build, or not at all.  Every problem
+// found is reported, one per line.
+func (r *Record) Validate() error {
+	problems := []string{}
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	// Inputs must be there.  A missing data directory just means no data.
+	dirs := []dirCheck{
+		{"Directories.TemplateDir", r.Directories.TemplateDir, false},
+		{"Directories.ImagesDir", r.Directories.ImagesDir, false},
+		{"Directories.TransparentDir", r.Directories.TransparentDir, false},
+		{"Directories.PoDir", r.Directories.PoDir, false},
+		{"Directories.DataDir", r.Directories.DataDir, true},
+		{"Directories.OverrideDir", r.Directories.OverrideDir, false},
+	}
+	for i, dir := range r.Directories.SharedDirs {
+		dirs = append(dirs, dirCheck{fmt.Sprintf("Directories.SharedDirs[%d]", i), dir, false})
+	}
+	for _, d := range dirs {
+		if d.path == "" {
+			continue
+		}
+		fi, err := os.Stat(d.path)
+		switch {
+		case os.IsNotExist(err) && d.optional:
+		case err != nil:
+			add("%s: %v", d.name, err)
+		case !fi.IsDir():
+			add("%s: %s is not a directory", d.name, d.path)
+		}
+	}
+	if _, err := os.Stat(r.Directories.SitesFile); err != nil {
+		add("Directories.SitesFile: %v", err)
+	}
+
+	// The output directory is wiped before every build.
+	if err := r.checkOutputDir(); err != nil {
+		add("Directories.OutputDir: %v", err)
+	}
+
+	// Processors must exist, and only use macros we know how to fill in.
+	lists := map[string][]process.Step{
+		"JS":     r.Processors.JS,
+		"CSS":    r.Processors.CSS,
+		"HTML":   r.Processors.HTML,
+		"PHP":    r.Processors.PHP,
+		"Apache": r.Processors.Apache,
+	}
+	names := []string{}
+	for name := range lists {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for i := range lists[name] {
+			if err := lists[name][i].Check(); err != nil {
+				add("Processors.%s[%d]: %v", name, i, err)
+			}
+		}
+	}
+
+	if r.Options.MaxThreads < 0 || r.Options.MaxThreads > MaxThreadsLimit {
+		add("Options.MaxThreads: %d is out of range (0 for automatic, up to %d)", r.Options.MaxThreads, MaxThreadsLimit)
+	}
+	if r.Options.MaxIncludeDepth < 1 {
+		add("Options.MaxIncludeDepth: %d must be at least 1", r.Options.MaxIncludeDepth)
+	}
+
+	if r.Options.KeepBuilds != nil && *r.Options.KeepBuilds < 0 {
+		add("Options.KeepBuilds: %d must not be negative", *r.Options.KeepBuilds)
+	}
+	if r.Options.MinTranslated < 0 || r.Options.MinTranslated > 100 {
+		add("Options.MinTranslated: %d is not a percentage", r.Options.MinTranslated)
+	}
+	if r.Options.MinSavings < 0 || r.Options.MinSavings >= 1 {
+		add("Options.MinSavings: %v must be a fraction, from 0 up to (not including) 1", r.Options.MinSavings)
+	}
+
+	for _, name := range r.ProfileNames() {
+		if _, err := r.ProfileChain(name); err != nil {
+			add("Profiles: %v", err)
+		}
+	}
+
+	if err := r.CheckPipeline(); err != nil {
+		add("%v", err)
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid config:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// checkOutputDir refuses output directories that replacing would hurt:
+// the filesystem root, the home directory, or anything holding or
+// inside of the templates and other inputs.
+func (r *Record) checkOutputDir() error {
+	if strings.TrimSpace(r.Directories.OutputDir) == "" {
+		return fmt.Errorf("must not be empty")
+	}
+	// The output directory itself is usually our symlink to the latest
+	// build; it's where it sits that matters.
+	parent, err := fileutil.RealPath(filepath.Dir(filepath.Clean(r.Directories.OutputDir)))
+	if err != nil {
+		return err
+	}
+	out := filepath.Join(parent, filepath.Base(r.Directories.OutputDir))
+	if out == "/" {
+		return fmt.Errorf("refusing to use /")
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		if h, err := fileutil.RealPath(home); err == nil && h == out {
+			return fmt.Errorf("refusing to use the home directory %s", out)
+		}
+	}
+	if cwd, err := os.Getwd(); err == nil {
+		if c, err := fileutil.RealPath(cwd); err == nil && fileutil.Within(out, c) {
+			return fmt.Errorf("%s holds the current directory", out)
+		}
+	}
+
+	inputs := map[string]string{
+		"TemplateDir":    r.Directories.TemplateDir,
+		"ImagesDir":      r.Directories.ImagesDir,
+		"TransparentDir": r.Directories.TransparentDir,
+		"PoDir":          r.Directories.PoDir,
+	}
+	names := []string{}
+	for name := range inputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		in, err := fileutil.RealPath(inputs[name])
+		if err != nil {
+			return err
+		}
+		if fileutil.Within(in, out) {
+			return fmt.Errorf("%s is inside %s %s", out, name, in)
+		}
+		if fileutil.Within(out, in) {
+			return fmt.Errorf("%s holds %s %s", out, name, in)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Extensions lists the file types Decode understands.
+var Extensions = []string{".json", ".yaml", ".yml"}
+
+// Set holds the data files loaded from a directory.  Files directly in the
+// directory are shared by every locale; files in a subdirectory named for
+// a language (fr) or locale (fr_FR) override them for that locale.
+type Set struct {
+	Base    map[string]interface{}
+	Locales map[string]map[string]interface{}
+}
+
+// Decode parses JSON or YAML, chosen by the filename's extension, into
+// generic values: map[string]interface{}, []interface{}, and scalars.
+func Decode(filename string, b []byte) (interface{}, error) {
+	var v interface{}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+		if err := json.Unmarshal(b, &v); err != nil {
+			return nil, fmt.Errorf("%s: %v", filename, err)
+		}
+		return v, nil
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(b, &v); err != nil {
+			return nil, fmt.Errorf("%s: %v", filename, err)
+		}
+		return Normalize(v)
+	}
+	return nil, fmt.Errorf("%s: unknown data file type", filename)
+}
+
+// Normalize converts the map[interface{}]interface{} values the YAML
+// decoder produces into map[string]interface{}, so that the result can
+// be used from templates, or re-encoded as JSON.
+func Normalize(v interface{}) (interface{}, error) {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{})
+		for k, val := range t {
+			ks, ok := k.(string)
+			if !ok {
+				ks = fmt.Sprintf("%v", k)
+			}
+			n, err := Normalize(val)
+			if err != nil {
+				return nil, err
+			}
+			m[ks] = n
+		}
+		return m, nil
+	case map[string]interface{}:
+		for k, val := range t {
+			n, err := Normalize(val)
+			if err != nil {
+				return nil, err
+			}
+			t[k] = n
+		}
+		return t, nil
+	case []interface{}:
+		for i, val := range t {
+			n, err := Normalize(val)
+			if err != nil {
+				return nil, err
+			}
+			t[i] = n
+		}
+		return t, nil
+	}
+	return v, nil
+}
+
+// isData reports whether a file name has one of the Extensions.
+func isData(fn string) bool {
+	ext := strings.ToLower(filepath.Ext(fn))
+	for _, e := range Extensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// loadFiles reads every data file directly in dir, keyed by base name.
+func loadFiles(dir string) (map[string]interface{}, error) {
+	found := make(map[string]interface{})
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, fi := range entries {
+		if fi.IsDir() || !isData(fi.Name()) {
+			continue
+		}
+		fn := filepath.Join(dir, fi.Name())
+		b, err := ioutil.ReadFile(fn)
+		if err != nil {
+			return nil, err
+		}
+		v, err := Decode(fn, b)
+		if err != nil {
+			return nil, err
+		}
+		name := strings.TrimSuffix(fi.Name(), filepath.Ext(fi.Name()))
+		if _, ok := found[name]; ok {
+			return nil, fmt.Errorf("%s: more than one data file named %s", dir, name)
+		}
+		found[name] = v
+	}
+	return found, nil
+}
+
+// LoadDir loads the data files under dir.  A missing directory is
+// not an error; it simply provides no data.
+func LoadDir(dir string) (*Set, error) {
+	s := &Set{
+		Base:    make(map[string]interface{}),
+		Locales: make(map[string]map[string]interface{}),
+	}
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return s, nil
+	}
+
+	base, err := loadFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	s.Base = base
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, fi := range entries {
+		if !fi.IsDir() {
+			continue
+		}
+		overrides, err := loadFiles(filepath.Join(dir, fi.Name()))
+		if err != nil {
+			return nil, err
+		}
+		s.Locales[fi.Name()] = overrides
+	}
+	return s, nil
+}
+
+// Merge returns base with override laid over it.  Maps are merged key by
+// key; anything else in override replaces what base had.
+func Merge(base interface{}, override interface{}) interface{} {
+	bm, ok1 := base.(map[string]interface{})
+	om, ok2 := override.(map[string]interface{})
+	if !ok1 || !ok2 {
+		return override
+	}
+	m := make(map[string]interface{})
+	for k, v := range bm {
+		m[k] = v
+	}
+	for k, v := range om {
+		if old, ok := m[k]; ok {
+			m[k] = Merge(old, v)
+		} else {
+			m[k] = v
+		}
+	}
+	return m
+}
+
+// ForLocale returns the data as seen by one locale: the shared files,
+// then the language's overrides, then the locale's.
+func (s *Set) ForLocale(locale string) map[string]interface{} {
+	var merged interface{} = s.Base
+	lang := strings.Split(locale, "_")[0]
+	for _, name := range []string{lang, locale} {
+		if overrides, ok := s.Locales[name]; ok {
+			merged = Merge(merged, overrides)
+		}
+		if lang == locale {
+			break
+		}
+	}
+	return merged.(map[string]interface{})
+}
+
+// Names lists the top level names available to templates, sorted.
+func (s *Set) Names() []string {
+	seen := make(map[string]bool)
+	for k := range s.Base {
+		seen[k] = true
+	}
+	for _, overrides := range s.Locales {
+		for k := range overrides {
+			seen[k] = true
+		}
+	}
+	names := []string{}
+	for k := range seen {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,70 @@
+package data
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "data_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name string, content string) {
+		fn := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(fn), 0755)
+		ioutil.WriteFile(fn, []byte(content), 0644)
+	}
+	write("site.yaml", "name: test-ipv6.com\ncontact:\n  email: jfesler@test-ipv6.com\n  name: Jason\n")
+	write("list.json", `["a", "b"]`)
+	write("fr/site.yaml", "contact:\n  name: Jean\n")
+	write("fr_CA/site.json", `{"name": "test-ipv6.ca"}`)
+	write("notes.txt", "ignored")
+
+	s, err := LoadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := s.Names(), []string{"list", "site"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Names: got %v, want %v", got, want)
+	}
+
+	var table = []struct {
+		locale  string
+		name    string
+		contact string
+	}{
+		{"en_US", "test-ipv6.com", "Jason"},
+		{"fr_FR", "test-ipv6.com", "Jean"},
+		{"fr_CA", "test-ipv6.ca", "Jean"},
+	}
+	for _, tt := range table {
+		site := s.ForLocale(tt.locale)["site"].(map[string]interface{})
+		contact := site["contact"].(map[string]interface{})
+		if site["name"] != tt.name || contact["name"] != tt.contact {
+			t.Errorf("%s: got %v", tt.locale, site)
+		}
+		if contact["email"] != "jfesler@test-ipv6.com" {
+			t.Errorf("%s: lost the email in merging: %v", tt.locale, contact)
+		}
+	}
+
+	// The base must not be modified by merging.
+	if s.Base["site"].(map[string]interface{})["name"] != "test-ipv6.com" {
+		t.Errorf("base was modified: %v", s.Base)
+	}
+}
+
+func TestLoadDirMissing(t *testing.T) {
+	s, err := LoadDir("no-such-directory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.ForLocale("en_US")) != 0 {
+		t.Errorf("expected no data, got %v", s.ForLocale("en_US"))
+	}
+}
@@ -0,0 +1,72 @@
+package fileutil
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrOutside is Search's error for a name that would escape every one of
+// its directories.
+var ErrOutside = errors.New("outside of the search path")
+
+// Within reports whether path is dir, or somewhere below it.
+// Both are expected to be absolute and clean.
+func Within(dir string, path string) bool {
+	if path == dir {
+		return true
+	}
+	return strings.HasPrefix(path, strings.TrimSuffix(dir, "/")+"/")
+}
+
+// RealPath makes a path absolute, and resolves symlinks when it can.
+// Files that do not exist yet are left for the caller to complain about.
+func RealPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		return resolved, nil
+	}
+	return abs, nil
+}
+
+// Search finds name in the first of dirs holding it as a file, and returns
+// its real path along with that directory (as given).  A name that would
+// escape every directory, via ".." or a symlink, is refused outright with
+// ErrOutside rather than skipped; the path it resolved to is still
+// returned, for messages.  If no directory has it, the error is
+// os.ErrNotExist.
+func Search(dirs []string, name string) (string, string, error) {
+	allowed := []string{}
+	for _, dir := range dirs {
+		abs, err := RealPath(dir)
+		if err != nil {
+			return "", "", err
+		}
+		allowed = append(allowed, abs)
+	}
+
+	for i, dir := range dirs {
+		full, err := RealPath(filepath.Join(allowed[i], name))
+		if err != nil {
+			return "", "", err
+		}
+		inside := false
+		for _, a := range allowed {
+			if Within(a, full) {
+				inside = true
+				break
+			}
+		}
+		if !inside {
+			return full, "", ErrOutside
+		}
+		if fi, err := os.Stat(full); err == nil && !fi.IsDir() {
+			return full, dir, nil
+		}
+	}
+	return "", "", os.ErrNotExist
+}
@@ -0,0 +1,49 @@
+package fileutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSearch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fileutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, content := range map[string]string{
+		"a/page.inc":   "a",
+		"b/page.inc":   "b",
+		"b/shared.inc": "shared",
+		"secret.txt":   "secret",
+	} {
+		fn := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(fn), 0755)
+		ioutil.WriteFile(fn, []byte(content), 0644)
+	}
+	os.Symlink(filepath.Join(dir, "secret.txt"), filepath.Join(dir, "a", "link.txt"))
+	dirs := []string{filepath.Join(dir, "a"), filepath.Join(dir, "b")}
+
+	for _, tt := range []struct {
+		name string
+		dir  string
+		err  error
+	}{
+		{"page.inc", dirs[0], nil},
+		{"shared.inc", dirs[1], nil},
+		{"../b/shared.inc", dirs[0], nil},
+		{"missing.inc", "", os.ErrNotExist},
+		{"../secret.txt", "", ErrOutside},
+		{"link.txt", "", ErrOutside},
+	} {
+		full, got, err := Search(dirs, tt.name)
+		if err != tt.err || got != tt.dir {
+			t.Errorf("%s: got %q, %v; want %q, %v", tt.name, got, err, tt.dir, tt.err)
+		}
+		if err == nil && filepath.Base(full) != filepath.Base(tt.name) {
+			t.Errorf("%s: resolved to %s", tt.name, full)
+		}
+	}
+}
@@ -9,15 +9,48 @@ type readFileCacheItem struct {
 	s string
 	e error
 }
-type readFileCacheType struct {
+
+// FileCache remembers file contents, so that templates included by many
+// pages are read from disk once.  Entries stay until Changed is called
+// for them.  A nil FileCache reads from disk every time.
+type FileCache struct {
 	lock   sync.RWMutex
 	byname map[string]readFileCacheItem
+	hooks  []func(paths []string)
+}
+
+// NewFileCache returns an empty FileCache.
+func NewFileCache() *FileCache {
+	return &FileCache{byname: make(map[string]readFileCacheItem)}
+}
+
+// cacheKey names a file the same way however it was reached.
+func cacheKey(fn string) string {
+	if real, err := RealPath(fn); err == nil {
+		return real
+	}
+	return fn
 }
 
-var readFileCache readFileCacheType
+// ReadFile will check the cache first, then fallback to ReadFileNoCache
+func (c *FileCache) ReadFile(fn string) (string, error) {
+	if c == nil {
+		return ReadFileNoCache(fn)
+	}
+	key := cacheKey(fn)
+	c.lock.RLock()
+	item, ok := c.byname[key]
+	c.lock.RUnlock()
+	if ok {
+		return item.s, item.e
+	}
 
-func init() {
-	readFileCache.byname = make(map[string]readFileCacheItem)
+	// Crap. Go read it for real.
+	s, e := ReadFileNoCache(fn)
+	c.lock.Lock()
+	c.byname[key] = readFileCacheItem{s: s, e: e}
+	c.lock.Unlock()
+	return s, e
 }
 
 // ReadFileNoCache Read a file from disk, return as a string.
@@ -26,16 +59,29 @@ func ReadFileNoCache(fn string) (string, error) {
 	return string(b), e
 }
 
-// ReadFile will check the cache first, then fallback to ReadFileFromDisk
-func ReadFile(fn string) (string, error) {
-	readFileCache.lock.Lock()
-	defer readFileCache.lock.Unlock()
-	if item, ok := readFileCache.byname[fn]; ok {
-		return item.s, item.e
+// OnChange registers f to be called with the paths given to Changed,
+// so that caches built from this one's contents can drop stale entries.
+func (c *FileCache) OnChange(f func(paths []string)) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.hooks = append(c.hooks, f)
+}
+
+// Changed says that files have changed on disk (or appeared, or gone):
+// they are dropped from the cache, and every OnChange hook is told.
+func (c *FileCache) Changed(paths ...string) {
+	real := make([]string, len(paths))
+	for i, fn := range paths {
+		real[i] = cacheKey(fn)
 	}
 
-	// Crap. Go read it for real.
-	s, e := ReadFileNoCache(fn)
-	readFileCache.byname[fn] = readFileCacheItem{s: s, e: e}
-	return s, e
+	c.lock.Lock()
+	for _, key := range real {
+		delete(c.byname, key)
+	}
+	hooks := append([]func([]string){}, c.hooks...)
+	c.lock.Unlock()
+	for _, f := range hooks {
+		f(real)
+	}
 }
@@ -0,0 +1,42 @@
+package fileutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestChanged(t *testing.T) {
+	dir, err := ioutil.TempDir("", "readfile_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn := filepath.Join(dir, "a.inc")
+	ioutil.WriteFile(fn, []byte("one"), 0644)
+
+	c := NewFileCache()
+	heard := []string{}
+	c.OnChange(func(paths []string) {
+		heard = append(heard, paths...)
+	})
+
+	if s, _ := c.ReadFile(fn); s != "one" {
+		t.Fatalf("got %q", s)
+	}
+	ioutil.WriteFile(fn, []byte("two"), 0644)
+	if s, _ := c.ReadFile(fn); s != "one" {
+		t.Errorf("expected the cached copy, got %q", s)
+	}
+
+	// Reached by a different spelling of the same path.
+	c.Changed(filepath.Join(dir, ".", "a.inc"))
+	if s, _ := c.ReadFile(fn); s != "two" {
+		t.Errorf("expected a fresh read after Changed, got %q", s)
+	}
+	real, _ := RealPath(fn)
+	if len(heard) != 1 || heard[0] != real {
+		t.Errorf("hook heard %v, want [%s]", heard, real)
+	}
+}
@@ -0,0 +1,13 @@
+module github.com/falling-sky/builder
+
+go 1.25
+
+require (
+	github.com/BurntSushi/toml v1.6.0
+	github.com/andybalholm/brotli v1.2.6
+	github.com/fsnotify/fsnotify v1.10.1
+	github.com/klauspost/compress v1.20.1
+	gopkg.in/yaml.v2 v2.4.0
+)
+
+require golang.org/x/sys v0.13.0 // indirect
@@ -0,0 +1,458 @@
+package job
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/falling-sky/builder/fileutil"
+	"github.com/falling-sky/builder/process"
+)
+
+// CacheVersion is part of every cache key.  Bump it when a change to the
+// builder changes what it writes, in case the builder's own hash doesn't.
+const CacheVersion = 2
+
+// BuildCache keeps the outputs of earlier jobs, keyed by a hash of all
+// their inputs, so that unchanged jobs can be copied instead of rebuilt.
+// Files read by the include and readFile template functions are only
+// known once a job has run; they are listed in its entry, and checked
+// before the entry is used.
+//
+//	DIR/objects/ab/cdef...   file contents, named by their sha256
+//	DIR/jobs/KEY.json        the outputs of the job whose other inputs hash to KEY
+//	DIR/last/ID.json         the input hashes a job was last built with,
+//	                         used to explain why it was rebuilt
+type BuildCache struct {
+	Dir     string
+	Explain bool // Log why each job was, or wasn't, rebuilt
+	version string
+	lock    sync.Mutex
+	hits    int
+	misses  int
+}
+
+// cacheEntry is what DIR/jobs/KEY.json and DIR/last/ID.json hold.
+type cacheEntry struct {
+	Key         string
+	Parts       map[string]string // Input name to hash
+	Outputs     []cacheOutput
+	Reads       []string             `json:",omitempty"` // Names template functions read; hashed in Parts as "template NAME"
+	Diagnostics []process.Diagnostic `json:",omitempty"` // What its processors said, for the report
+}
+
+// cacheOutput is one file a job wrote, relative to the output directory.
+type cacheOutput struct {
+	Name string
+	Hash string
+	Mode os.FileMode
+}
+
+// OpenCache opens (creating if need be) the cache in dir.
+func OpenCache(dir string, explain bool) (*BuildCache, error) {
+	for _, sub := range []string{"objects", "jobs", "last"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			return nil, err
+		}
+	}
+	c := &BuildCache{Dir: dir, Explain: explain, version: fmt.Sprintf("%d", CacheVersion)}
+
+	// A rebuilt builder may write different output; don't trust old entries.
+	if exe, err := os.Executable(); err == nil {
+		if h, err := hashFile(exe); err == nil {
+			c.version += " " + h
+		}
+	}
+	return c, nil
+}
+
+// Stats reports how many jobs were copied from the cache, and how many built.
+func (c *BuildCache) Stats() (int, int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.hits, c.misses
+}
+
+// jobID names a job independent of its inputs: directory, file and locale.
+func jobID(qi *QueueItem) string {
+	return qi.PostInfo.Directory + "/" + qi.Filename + " " + qi.PoFile.Language
+}
+
+// jobParts hashes each of the inputs that decide a job's output.
+func (c *BuildCache) jobParts(qi *QueueItem, src *Source) map[string]string {
+	parts := make(map[string]string)
+	parts["builder version"] = hashString(c.version)
+
+	// The template, and everything it pulled in.
+	var files func(s *Source)
+	files = func(s *Source) {
+		for _, o := range s.Origins {
+			parts["template "+o.File] = hashString(o.Content)
+		}
+		for _, layer := range s.Layers {
+			files(layer)
+		}
+	}
+	files(src)
+
+	// The catalog entries for the text it translates.
+	h := sha256.New()
+	var catalog func(s *Source)
+	catalog = func(s *Source) {
+		for _, m := range reTRANSLATE.FindAllStringSubmatch(s.Text, -1) {
+			fmt.Fprintf(h, "%q=%q\n", m[1], qi.PoFile.Translate(m[1], qi.PostInfo.EscapeQuote))
+		}
+		for _, layer := range s.Layers {
+			catalog(layer)
+		}
+	}
+	catalog(src)
+	parts["catalog "+qi.PoFile.Language] = hex.EncodeToString(h.Sum(nil))
+
+	// The data it reads.
+	use := src.dataUses(qi)
+	fields := make(map[string]json.RawMessage)
+	b, err := json.Marshal(templateDataForKey(qi.Data, use))
+	if err != nil {
+		log.Fatal(err)
+	}
+	json.Unmarshal(b, &fields)
+	for name, v := range fields {
+		if name == "PoStats" || use.reads(name) {
+			parts["template data ."+name] = hashBytes(v)
+		}
+	}
+	parts["processing"] = hashJSON(struct {
+		PostInfo PostInfoType
+		Output   string
+	}{qi.PostInfo, OutputName(qi)})
+	return parts
+}
+
+// templateDataForKey is TemplateData, less the translation catalogs
+// (which are large, and hashed separately); templates only see their
+// statistics.  Those of other locales are left out, unless the template
+// reads more of PoMap than its own locale's entry.
+func templateDataForKey(td *TemplateData, use *dataUse) interface{} {
+	if td == nil {
+		return struct{}{}
+	}
+	stats := make(map[string][2]int)
+	for locale, f := range td.PoMap {
+		if use.reads("PoMap") || use.ownStats && locale == td.Locale {
+			stats[locale] = [2]int{f.Translated, f.OutOf}
+		}
+	}
+	rest := *td
+	rest.PoMap = nil
+	return struct {
+		TemplateData
+		PoStats map[string][2]int
+	}{rest, stats}
+}
+
+// keyOf combines the part hashes into the job's cache key.
+func keyOf(parts map[string]string) string {
+	names := []string{}
+	for name := range parts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	h := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(h, "%s=%s\n", name, parts[name])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Restore copies a job's outputs from the cache, if its inputs are
+// unchanged.  It returns the key and part hashes for Save either way.
+func (c *BuildCache) Restore(qi *QueueItem, src *Source) (bool, string, map[string]string) {
+	parts := c.jobParts(qi, src)
+	key := keyOf(parts)
+
+	e := &cacheEntry{}
+	ok := readJSON(filepath.Join(c.Dir, "jobs", key+".json"), e) == nil
+	for _, name := range e.Reads {
+		ok = ok && e.Parts["template "+name] == readHash(qi, name)
+	}
+	if ok {
+		for _, out := range e.Outputs {
+			if err := c.copyOut(out, qi.Config.Directories.OutputDir); err != nil {
+				log.Printf("cache: %s: %v; rebuilding\n", jobID(qi), err)
+				ok = false
+				break
+			}
+			qi.extras = append(qi.extras, out.Name)
+		}
+	}
+	if ok {
+		qi.Report.AddCached(qi, e.Diagnostics)
+		src.noteReads(searchPath(qi), e.Reads)
+	} else {
+		qi.extras = nil
+	}
+
+	c.lock.Lock()
+	if ok {
+		c.hits++
+	} else {
+		c.misses++
+	}
+	c.lock.Unlock()
+
+	if c.Explain {
+		if ok {
+			log.Printf("explain: %s: up to date\n", jobID(qi))
+		} else {
+			log.Printf("explain: %s: %s\n", jobID(qi), c.why(qi, parts))
+		}
+	}
+	return ok, key, parts
+}
+
+// why compares a job's inputs with those it was last built with.
+func (c *BuildCache) why(qi *QueueItem, parts map[string]string) string {
+	last := &cacheEntry{}
+	if err := readJSON(c.lastFile(qi), last); err != nil {
+		return "not built before"
+	}
+	parts = withReads(qi, parts, last.Reads)
+	if last.Parts["builder version"] != parts["builder version"] {
+		return "builder version changed"
+	}
+	changed := []string{}
+	for name, h := range parts {
+		if old, ok := last.Parts[name]; !ok {
+			changed = append(changed, name+" added")
+		} else if old != h {
+			changed = append(changed, name+" changed")
+		}
+	}
+	for name := range last.Parts {
+		if _, ok := parts[name]; !ok {
+			changed = append(changed, name+" removed")
+		}
+	}
+	if len(changed) == 0 {
+		return "cached outputs missing"
+	}
+	sort.Strings(changed)
+	return strings.Join(changed, ", ")
+}
+
+func (c *BuildCache) lastFile(qi *QueueItem) string {
+	return filepath.Join(c.Dir, "last", hashString(jobID(qi))+".json")
+}
+
+// Save records the outputs of a job that was just built; see jobOutputs.
+func (c *BuildCache) Save(qi *QueueItem, key string, parts map[string]string) error {
+	outDir := qi.Config.Directories.OutputDir
+	names, err := jobOutputs(qi)
+	if err != nil {
+		return err
+	}
+
+	reads := uniq(qi.reads)
+	parts = withReads(qi, parts, reads)
+	e := &cacheEntry{Key: key, Parts: parts, Reads: reads, Diagnostics: qi.diagnostics}
+	for _, rel := range names {
+		fn := filepath.Join(outDir, rel)
+		fi, err := os.Stat(fn)
+		if err != nil {
+			return err
+		}
+		h, err := c.store(fn)
+		if err != nil {
+			return err
+		}
+		e.Outputs = append(e.Outputs, cacheOutput{Name: rel, Hash: h, Mode: fi.Mode().Perm()})
+	}
+	if err := writeJSON(filepath.Join(c.Dir, "jobs", key+".json"), e); err != nil {
+		return err
+	}
+	return writeJSON(c.lastFile(qi), &cacheEntry{Key: key, Parts: parts, Reads: reads})
+}
+
+// withReads returns parts, plus a hash for each of the names template
+// functions read.
+func withReads(qi *QueueItem, parts map[string]string, reads []string) map[string]string {
+	all := make(map[string]string)
+	for name, h := range parts {
+		all[name] = h
+	}
+	for _, name := range reads {
+		all["template "+name] = readHash(qi, name)
+	}
+	return all
+}
+
+// readHash hashes what the include and readFile functions would find for
+// name now; a missing file hashes as such, since readFile allows them.
+func readHash(qi *QueueItem, name string) string {
+	full, _, err := fileutil.Search(searchPath(qi), name)
+	if err != nil {
+		return hashString("missing")
+	}
+	h, err := hashFile(full)
+	if err != nil {
+		return hashString("missing")
+	}
+	return h
+}
+
+// uniq returns names sorted, without repeats.
+func uniq(names []string) []string {
+	seen := make(map[string]bool)
+	out := []string{}
+	for _, name := range names {
+		if !seen[name] {
+			seen[name] = true
+			out = append(out, name)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// jobOutputs lists the files a job wrote, relative to the output
+// directory: those of outputFiles it left there, and the extras it
+// noted, such as a source map.
+func jobOutputs(qi *QueueItem) ([]string, error) {
+	outDir := qi.Config.Directories.OutputDir
+	seen := make(map[string]bool)
+	names := []string{}
+	for _, rel := range append(outputFiles(qi), qi.extras...) {
+		if seen[rel] {
+			continue
+		}
+		seen[rel] = true
+		fi, err := os.Stat(filepath.Join(outDir, rel))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if fi.Mode().IsRegular() {
+			names = append(names, rel)
+		}
+	}
+	return names, nil
+}
+
+// object is where content with hash h is kept.
+func (c *BuildCache) object(h string) string {
+	return filepath.Join(c.Dir, "objects", h[:2], h[2:])
+}
+
+// store adds a file to the objects directory, returning its hash.
+func (c *BuildCache) store(fn string) (string, error) {
+	b, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return "", err
+	}
+	h := hashBytes(b)
+	obj := c.object(h)
+	if _, err := os.Stat(obj); err == nil {
+		return h, nil
+	}
+	return h, writeAtomic(obj, b, 0644)
+}
+
+// copyOut writes a cached output into the output directory.
+func (c *BuildCache) copyOut(out cacheOutput, outDir string) error {
+	b, err := ioutil.ReadFile(c.object(out.Hash))
+	if err != nil {
+		return err
+	}
+	if hashBytes(b) != out.Hash {
+		return fmt.Errorf("%s: corrupt cache object", out.Name)
+	}
+	fn := filepath.Join(outDir, out.Name)
+	if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fn, b, out.Mode)
+}
+
+// writeAtomic writes a file by way of a temporary one, so that readers
+// (including other builds sharing the cache) never see half of it.
+func writeAtomic(fn string, b []byte, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(fn), ".tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(b)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), mode)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), fn)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+func readJSON(fn string, v interface{}) error {
+	b, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func writeJSON(fn string, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", " ")
+	if err != nil {
+		return err
+	}
+	return writeAtomic(fn, b, 0644)
+}
+
+func hashBytes(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+func hashString(s string) string {
+	return hashBytes([]byte(s))
+}
+
+func hashJSON(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return hashBytes(b)
+}
+
+func hashFile(fn string) (string, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
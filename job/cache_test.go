@@ -0,0 +1,241 @@
+package job
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/falling-sky/builder/config"
+	"github.com/falling-sky/builder/po"
+	"github.com/falling-sky/builder/process"
+)
+
+func TestBuildCache(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"html/index.html": "[% PROCESS \"inc.inc\" %] {{hello}} [% .Vars.x %]",
+		"html/inc.inc":    strings.Repeat("included ", 20),
+	})
+	defer os.RemoveAll(dir)
+
+	c, err := OpenCache(dir+"/cache", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	qi := testItem(dir+"/html", "index.html")
+	qi.Config = &config.Record{}
+	qi.Config.Directories.OutputDir = dir + "/out"
+	qi.PostInfo = PostInfoType{Directory: "html", MultiLocale: true, Precompress: []string{"gzip", "br"}}
+
+	build := func() bool {
+		src, err := Expand(qi)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hit, key, parts := c.Restore(qi, src)
+		if !hit {
+			ProcessContent(qi, TranslateContent(qi, ProcessTemplate(qi, src)))
+			if err := c.Save(qi, key, parts); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return hit
+	}
+
+	if build() {
+		t.Fatal("first build came from the cache")
+	}
+	os.RemoveAll(dir + "/out")
+	if !build() {
+		t.Fatal("second build was not from the cache")
+	}
+	for _, fn := range []string{"index.html.fr_FR", "index.html.gz.fr_FR", "index.html.br.fr_FR"} {
+		if _, err := os.Stat(filepath.Join(dir, "out", fn)); err != nil {
+			t.Errorf("not restored: %v", err)
+		}
+	}
+
+	ioutil.WriteFile(dir+"/html/inc.inc", []byte("changed"), 0644)
+	src, _ := Expand(qi)
+	if hit, _, parts := c.Restore(qi, src); hit {
+		t.Error("changed include came from the cache")
+	} else if why := c.why(qi, parts); why != "template inc.inc changed" {
+		t.Errorf("why: got %q", why)
+	}
+
+	qi.Data.Vars = map[string]interface{}{"x": 1}
+	if _, _, parts := c.Restore(qi, src); !strings.Contains(c.why(qi, parts), "template data .Vars changed") {
+		t.Errorf("why: got %q", c.why(qi, parts))
+	}
+}
+
+// TestCacheKeyDataUse checks that jobs are keyed on the data their
+// templates read, and not the rest.
+func TestCacheKeyDataUse(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"html/index.html":     "[% with index .PoMap .Locale %][% .Translated %][% end %] {{hello}}",
+		"html/other.html":     "other",
+		"apache/dot.htaccess": "# [% .DirSignature %]",
+	})
+	defer os.RemoveAll(dir)
+	c, err := OpenCache(dir+"/cache", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := map[string]*po.File{"fr_FR": {Translated: 1, OutOf: 2}, "de_DE": {Translated: 1, OutOf: 2}}
+	item := func(sub string, file string) *QueueItem {
+		qi := testItem(dir+"/"+sub, file)
+		qi.Config = &config.Record{}
+		qi.Config.Directories.OutputDir = dir + "/out"
+		qi.PostInfo = PostInfoType{Directory: sub, MultiLocale: true}
+		qi.Data.PoMap = stats
+		qi.Data.DirSignature = "one"
+		return qi
+	}
+	page, htaccess := item("html", "index.html"), item("apache", "dot.htaccess")
+	build := func(qi *QueueItem) (bool, string) {
+		src, err := Expand(qi)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hit, key, parts := c.Restore(qi, src)
+		why := c.why(qi, parts)
+		if !hit {
+			ProcessContent(qi, TranslateContent(qi, ProcessTemplate(qi, src)))
+			if err := c.Save(qi, key, parts); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return hit, why
+	}
+	build(page)
+	build(htaccess)
+
+	// Another template changes, and so does another locale's catalog.
+	ioutil.WriteFile(dir+"/html/other.html", []byte("changed"), 0644)
+	page.Data.DirSignature, htaccess.Data.DirSignature = "two", "two"
+	stats["de_DE"].Translated = 2
+	if hit, why := build(page); !hit {
+		t.Errorf("index.html was rebuilt: %s", why)
+	}
+	if hit, why := build(htaccess); hit || why != "template data .DirSignature changed" {
+		t.Errorf("dot.htaccess: hit %v, why %q", hit, why)
+	}
+
+	stats["fr_FR"].Translated = 2
+	if hit, why := build(page); hit || why != "template data .PoStats changed" {
+		t.Errorf("own locale's statistics: hit %v, why %q", hit, why)
+	}
+}
+
+// TestCacheDiagnostics checks that a job restored from the cache still
+// reports what its processors said when it was built.
+func TestCacheDiagnostics(t *testing.T) {
+	dir := writeTree(t, map[string]string{"html/index.html": "<p>hi</p>", "out/.keep": ""})
+	defer os.RemoveAll(dir)
+	c, err := OpenCache(dir+"/cache", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	build := func() *Report {
+		qi := testItem(dir+"/html", "index.html")
+		qi.Config = &config.Record{}
+		qi.Config.Directories.OutputDir = dir + "/out"
+		qi.PostInfo = PostInfoType{Directory: "html", MultiLocale: true, PostProcess: []process.Step{
+			{Processor: "exec", Args: []string{"sh", "-c", "cat; echo warning >&2"}},
+		}}
+		qi.Cache = c
+		qi.Report = NewReport()
+		RunJob(qi)
+		return qi.Report
+	}
+	if r := build(); len(r.Steps) != 1 || r.Steps[0].Cached {
+		t.Fatalf("first build: %+v", r.Steps)
+	}
+	r := build()
+	if hits, _ := c.Stats(); hits != 1 {
+		t.Fatalf("%d cache hits, want 1", hits)
+	}
+	if len(r.Steps) != 1 || !r.Steps[0].Cached || r.Steps[0].Stderr != "warning\n" {
+		t.Errorf("cached build: %+v", r.Steps)
+	}
+}
+
+// TestCacheFunctionReads checks that files read by the include and
+// readFile functions are inputs, even one that wasn't there.
+func TestCacheFunctionReads(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"html/index.html": `[% include "note.txt" %] [% readFile "optional.txt" %]`,
+		"html/note.txt":   "note",
+	})
+	defer os.RemoveAll(dir)
+	c, err := OpenCache(dir+"/cache", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	build := func() (bool, string) {
+		qi := testItem(dir+"/html", "index.html")
+		qi.Config = &config.Record{}
+		qi.Config.Directories.OutputDir = dir + "/out"
+		qi.PostInfo = PostInfoType{Directory: "html", MultiLocale: true}
+		src, err := Expand(qi)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hit, key, parts := c.Restore(qi, src)
+		why := c.why(qi, parts)
+		if !hit {
+			ProcessContent(qi, ProcessTemplate(qi, src))
+			if err := c.Save(qi, key, parts); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return hit, why
+	}
+	build()
+	if hit, why := build(); !hit {
+		t.Fatalf("unchanged: %s", why)
+	}
+	ioutil.WriteFile(dir+"/html/note.txt", []byte("changed"), 0644)
+	if hit, why := build(); hit || why != "template note.txt changed" {
+		t.Errorf("include: hit %v, why %q", hit, why)
+	}
+	ioutil.WriteFile(dir+"/html/optional.txt", []byte("now here"), 0644)
+	if hit, why := build(); hit || why != "template optional.txt changed" {
+		t.Errorf("readFile: hit %v, why %q", hit, why)
+	}
+}
+
+// TestJobOutputs checks that a job claims only its own files, not those
+// of locales whose names start with its own.
+func TestJobOutputs(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"out/index.html.pt":        "pt",
+		"out/index.html.gz.pt":     "pt, zipped",
+		"out/index.html.pt.map":    "map",
+		"out/index.html.pt_BR":     "pt_BR",
+		"out/index.html.gz.pt_BR":  "pt_BR, zipped",
+		"out/index.html.var":       "type map",
+		"out/index.html.pt.unused": "left over",
+	})
+	defer os.RemoveAll(dir)
+	qi := testItem(dir, "index.html")
+	qi.PoFile = &po.File{Language: "pt"}
+	qi.Config = &config.Record{}
+	qi.Config.Directories.OutputDir = dir + "/out"
+	qi.PostInfo = PostInfoType{Directory: "html", MultiLocale: true}
+	qi.extras = []string{"index.html.pt.map"}
+
+	got, err := jobOutputs(qi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(got)
+	want := []string{"index.html.gz.pt", "index.html.pt", "index.html.pt.map"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,84 @@
+package job
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/falling-sky/builder/precompress"
+	"github.com/falling-sky/builder/rewrite"
+)
+
+// encodedName is where a job's copy compressed by e goes.  The extension
+// comes before any locale, as in index.html.gz.en_US.
+func encodedName(qi *QueueItem, e *precompress.Encoder) string {
+	name := OutputName(qi) + e.Extension
+	if qi.PostInfo.MultiLocale {
+		name = name + "." + qi.PoFile.Language
+	}
+	return name
+}
+
+// outputFiles lists the files a job may write: its output, and a
+// compressed copy for each encoder, whether or not the job asks for it.
+func outputFiles(qi *QueueItem) []string {
+	name, _ := outputNames(qi)
+	files := []string{name}
+	for _, e := range precompress.All() {
+		files = append(files, encodedName(qi, e))
+	}
+	return files
+}
+
+// rewriteVariant applies the job's rewrite rules for one variant of its
+// output; see package rewrite.
+func rewriteVariant(qi *QueueItem, variant string, content string) string {
+	text, err := rewrite.Apply(qi.PostInfo.Rewrite, variant, content)
+	if err != nil {
+		fail(err)
+	}
+	return text
+}
+
+// writeOutput writes the plain copy of a job's output, rewritten.
+func writeOutput(qi *QueueItem, content string) {
+	name, _ := outputNames(qi)
+	fn := filepath.Join(qi.Config.Directories.OutputDir, name)
+
+	// Make sure the directory exists.
+	// We may need to keep track of this;
+	// do we really want to do this 1000+ times?
+	os.MkdirAll(filepath.Dir(fn), 0755)
+
+	content = rewriteVariant(qi, rewrite.Plain, content)
+	if err := ioutil.WriteFile(fn, []byte(content), 0644); err != nil {
+		fail(err)
+	}
+}
+
+// precompressOutput writes the compressed copies of content the job asks
+// for, except those in keep (written by processors).  Each is rewritten
+// for its encoding first.  A copy saving less than MinSavings is left
+// out, and any earlier one removed.
+func precompressOutput(qi *QueueItem, content string, keep map[string]bool) {
+	outDir := qi.Config.Directories.OutputDir
+	for _, e := range precompress.Select(qi.PostInfo.Precompress) {
+		name := encodedName(qi, e)
+		if keep[name] {
+			continue
+		}
+		text := rewriteVariant(qi, e.Name, content)
+		b, err := e.Encode([]byte(text))
+		if err != nil {
+			fail(err)
+		}
+		fn := filepath.Join(outDir, name)
+		if !precompress.Worthwhile(len(text), len(b), qi.PostInfo.MinSavings) {
+			os.Remove(fn)
+			continue
+		}
+		if err := ioutil.WriteFile(fn, b, 0644); err != nil {
+			fail(err)
+		}
+	}
+}
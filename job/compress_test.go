@@ -0,0 +1,138 @@
+package job
+
+import (
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/falling-sky/builder/assets"
+	"github.com/falling-sky/builder/config"
+	"github.com/falling-sky/builder/rewrite"
+)
+
+func TestPrecompress(t *testing.T) {
+	dir := writeTree(t, map[string]string{})
+	defer os.RemoveAll(dir)
+	qi := testItem(dir, "index.js")
+	qi.Config = &config.Record{}
+	qi.Config.Directories.OutputDir = dir
+	qi.PostInfo = PostInfoType{MultiLocale: true, Precompress: []string{"gzip", "br", "zstd"}}
+
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(dir, name))
+		return err == nil
+	}
+
+	ProcessContent(qi, strings.Repeat("var x = 1;\n", 100))
+	for _, name := range []string{"index.js.fr_FR", "index.js.gz.fr_FR", "index.js.br.fr_FR", "index.js.zst.fr_FR"} {
+		if !exists(name) {
+			t.Errorf("%s was not written", name)
+		}
+	}
+
+	// Short text doesn't compress; the old copies must go.
+	qi.PostInfo.MinSavings = 0.2
+	ProcessContent(qi, "x")
+	for _, name := range []string{"index.js.gz.fr_FR", "index.js.br.fr_FR", "index.js.zst.fr_FR"} {
+		if exists(name) {
+			t.Errorf("%s was kept, though it saves nothing", name)
+		}
+	}
+}
+
+func TestRewriteVariants(t *testing.T) {
+	dir := writeTree(t, map[string]string{})
+	defer os.RemoveAll(dir)
+	qi := testItem(dir, "index.html")
+	qi.Config = &config.Record{}
+	qi.Config.Directories.OutputDir = dir
+	rules := append(config.AssetRewrites(), rewrite.Rule{From: "IPv6", To: "IPv4", Variants: []string{rewrite.Plain}})
+	qi.PostInfo = PostInfoType{Precompress: []string{"gzip", "br"}, Rewrite: rules}
+
+	page := `<script src="/index.0123456789.js.fr_FR"></script>` + strings.Repeat("<p>IPv6</p>\n", 100)
+	ProcessContent(qi, page)
+
+	read := func(name string) string {
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if name == "index.html" {
+			b, _ := ioutil.ReadAll(f)
+			return string(b)
+		}
+		var r io.Reader = f
+		if strings.HasSuffix(name, ".gz") {
+			if r, err = gzip.NewReader(f); err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			r = brotli.NewReader(f)
+		}
+		b, _ := ioutil.ReadAll(r)
+		return string(b)
+	}
+	if got := read("index.html.gz"); !strings.Contains(got, `src="/index.0123456789.js.gz.fr_FR"`) {
+		t.Errorf("gzip copy not rewritten: %.40s", got)
+	}
+	if got := read("index.html.br"); got != page {
+		t.Errorf("br copy was rewritten: %.40s", got)
+	}
+	if got := read("index.html"); got != strings.Replace(page, "IPv6", "IPv4", -1) {
+		t.Errorf("plain copy was not rewritten: %.40s", got)
+	}
+}
+
+// TestAssetRewrites builds a fingerprinted script, then a page naming it,
+// and follows the gzipped page's reference.
+func TestAssetRewrites(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"js/index.js":     strings.Repeat("var a = 1;\n", 100),
+		"html/index.html": `<script src="[% asset "index.js" %]"></script>` + strings.Repeat("<p>IPv6</p>\n", 100),
+	})
+	defer os.RemoveAll(dir)
+	built := assets.NewManifest()
+	item := func(sub string, file string) *QueueItem {
+		qi := testItem(dir+"/"+sub, file)
+		qi.Config = &config.Record{}
+		qi.Config.Directories.OutputDir = dir + "/out"
+		qi.PostInfo = PostInfoType{Directory: sub, MultiLocale: true, Precompress: []string{"gzip"}}
+		return qi
+	}
+	script := item("js", "index.js")
+	script.PostInfo.Fingerprint = true
+	script.Assets = built
+	RunJob(script)
+	page := item("html", "index.html")
+	page.PostInfo.Rewrite = config.AssetRewrites()
+	page.Data.Assets = built
+	RunJob(page)
+
+	f, err := os.Open(dir + "/out/index.html.gz.fr_FR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(r)
+	m := regexp.MustCompile(`src="/([^"]+)"`).FindStringSubmatch(string(b))
+	if m == nil {
+		t.Fatalf("no script in %.60s", b)
+	}
+	if want := strings.Replace(built.Files["index.js.fr_FR"], ".js.", ".js.gz.", 1); m[1] != want {
+		t.Errorf("gzipped page names %s, want %s", m[1], want)
+	}
+	if _, err := os.Stat(dir + "/out/" + m[1]); err != nil {
+		t.Error(err)
+	}
+}
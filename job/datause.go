@@ -0,0 +1,157 @@
+package job
+
+import (
+	"text/template"
+	"text/template/parse"
+
+	"github.com/falling-sky/builder/tfuncs"
+)
+
+// dataUse is what a template reads of its TemplateData, so that the
+// job's cache key can leave out the rest.  Most templates never look at
+// DirSignature (which changes with any template edit), or at the
+// statistics of other locales (which change with any .po file).
+type dataUse struct {
+	all      bool            // The data is handed whole to a function
+	fields   map[string]bool // Fields read, as .Name or $.Name
+	ownStats bool            // index .PoMap .Locale: this locale's statistics, and no others
+}
+
+// implicitUse lists the fields template functions read for themselves;
+// see funcOptions.
+var implicitUse = map[string][]string{
+	"asset": {"Assets", "GitInfo", "Locale"},
+}
+
+// dataUses returns what s's templates read of their data.  It is the
+// same for every locale, so is worked out once.
+func (s *Source) dataUses(qi *QueueItem) *dataUse {
+	s.usesOnce.Do(func() {
+		s.uses = findDataUse(qi, s)
+	})
+	return s.uses
+}
+
+// findDataUse parses src as Render does, and walks the trees.  If it
+// won't parse, everything counts as used; the job will fail anyway.
+func findDataUse(qi *QueueItem, src *Source) *dataUse {
+	u := &dataUse{fields: make(map[string]bool)}
+	funcs := tfuncs.FuncMap(funcOptions(qi))
+	funcs["includeScope"] = includeScope
+	root := template.New(qi.Filename).Delims(`[%`, `%]`).Funcs(funcs)
+	if _, err := root.Parse(src.Text); err != nil {
+		u.all = true
+		return u
+	}
+	for _, layer := range src.Layers {
+		if _, err := root.New(layer.Name).Parse(layer.Text); err != nil {
+			u.all = true
+			return u
+		}
+	}
+	for _, t := range root.Templates() {
+		if t.Tree != nil {
+			u.walk(t.Tree.Root, true)
+		}
+	}
+	return u
+}
+
+// reads reports whether field is read, or might be.
+func (u *dataUse) reads(field string) bool {
+	return u.all || u.fields[field]
+}
+
+// walk notes the fields read below n.  rooted is true while dot is the
+// TemplateData (or an IncludeScope wrapping it), and not something
+// range or with has moved it to.
+func (u *dataUse) walk(n parse.Node, rooted bool) {
+	switch n := n.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			u.walk(c, rooted)
+		}
+	case *parse.ActionNode:
+		u.pipe(n.Pipe, rooted, false)
+	case *parse.IfNode:
+		u.branch(&n.BranchNode, rooted, rooted)
+	case *parse.RangeNode:
+		u.branch(&n.BranchNode, false, rooted)
+	case *parse.WithNode:
+		u.branch(&n.BranchNode, false, rooted)
+	case *parse.TemplateNode:
+		// Named templates are walked in their own right.
+		u.pipe(n.Pipe, rooted, true)
+	}
+}
+
+func (u *dataUse) branch(b *parse.BranchNode, body bool, rooted bool) {
+	u.pipe(b.Pipe, rooted, false)
+	u.walk(b.List, body)
+	if b.ElseList != nil {
+		u.walk(b.ElseList, rooted)
+	}
+}
+
+// pipe notes the fields read by a pipeline.  Dot may be passed on
+// whole where passOK (to a named template), or to includeScope.
+func (u *dataUse) pipe(p *parse.PipeNode, rooted bool, passOK bool) {
+	if p == nil {
+		return
+	}
+	for _, cmd := range p.Cmds {
+		args := cmd.Args
+		ok := passOK
+		if id, isFunc := args[0].(*parse.IdentifierNode); isFunc {
+			for _, f := range implicitUse[id.Ident] {
+				u.fields[f] = true
+			}
+			switch {
+			case id.Ident == "includeScope":
+				ok = true
+			case id.Ident == "index" && len(args) == 3 && isField(args[1], "PoMap") && isField(args[2], "Locale"):
+				u.ownStats = true
+				u.fields["Locale"] = true
+				args = nil
+			}
+		}
+		for _, arg := range args {
+			u.arg(arg, rooted, ok)
+		}
+	}
+}
+
+func (u *dataUse) arg(n parse.Node, rooted bool, passOK bool) {
+	switch n := n.(type) {
+	case *parse.FieldNode:
+		u.fields[n.Ident[0]] = true
+	case *parse.VariableNode:
+		if n.Ident[0] == "$" && len(n.Ident) > 1 {
+			u.fields[n.Ident[1]] = true
+		} else if n.Ident[0] == "$" && !passOK {
+			u.all = true
+		}
+	case *parse.DotNode:
+		if rooted && !passOK {
+			u.all = true
+		}
+	case *parse.ChainNode:
+		u.arg(n.Node, rooted, false)
+	case *parse.PipeNode:
+		u.pipe(n, rooted, false)
+	}
+}
+
+// isField is true if n is .name, or $.name.
+func isField(n parse.Node, name string) bool {
+	switch n := n.(type) {
+	case *parse.FieldNode:
+		return len(n.Ident) == 1 && n.Ident[0] == name
+	case *parse.VariableNode:
+		return len(n.Ident) == 2 && n.Ident[0] == "$" && n.Ident[1] == name
+	}
+	return false
+}
@@ -0,0 +1,329 @@
+package job
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/falling-sky/builder/fileutil"
+)
+
+// reEXTENDS matches  [% extends "layout" %]  with optional name=value parameters.
+// It is only honored as the very first thing in a page.
+var reEXTENDS = regexp.MustCompile(`\[\%\s*extends\s*"(.*?)"((?:\s+\w+\s*=\s*(?:"(?:[^"\\]|\\.)*"|[^\s"%]+))*)\s*\%\]`)
+
+// defaultMaxIncludeDepth applies when a QueueItem carries no config.
+const defaultMaxIncludeDepth = 16
+
+// searchPath lists the directories PROCESS names are looked up in, in order.
+func searchPath(qi *QueueItem) []string {
+	if qi.Config == nil {
+		return []string{qi.RootDir}
+	}
+	return qi.Config.IncludePath(qi.RootDir)
+}
+
+// resolveInclude maps the name used in a PROCESS directive to a file on disk.
+// Each directory on the search path is tried in turn; the first one holding
+// the file wins, and is returned along with the path.  A name that would
+// escape every directory on the search path (via "..", or a symlink) is
+// refused outright rather than skipped.
+func resolveInclude(qi *QueueItem, name string) (string, string, error) {
+	dirs := searchPath(qi)
+	full, dir, err := fileutil.Search(dirs, name)
+	switch {
+	case err == fileutil.ErrOutside:
+		return "", "", fmt.Errorf("%q resolves to %s, outside of the include path %s", name, full, strings.Join(dirs, ", "))
+	case os.IsNotExist(err):
+		return "", "", fmt.Errorf("%q not found in include path %s", name, strings.Join(dirs, ", "))
+	}
+	return full, dir, err
+}
+
+// extension records a page's  [% extends %]  directive.
+type extension struct {
+	layout   string
+	params   []param
+	origin   *Origin
+	originAt int
+}
+
+// Expand does the work for GrabContent, returning errors rather than
+// stopping the build.  Include cycles, excessive nesting, and names
+// that escape the include path are all errors.
+//
+// A page that starts with  [% extends "layouts/page.html" %]  is expanded
+// as its layout, with the page (and any layouts in between) kept as
+// separate Layers, to be parsed afterwards so their blocks win.
+//
+// On error, the Source returned has no text, but its Files are those
+// read before the error, so that a fix to one of them can be noticed.
+func Expand(qi *QueueItem) (*Source, error) {
+	counter := 0
+
+	// Walk from the page up to the base layout.
+	layers := []*Source{}
+	fn := qi.Filename
+	var parent *Origin
+	parentAt := 0
+	params := []param{}
+	for {
+		src := &Source{Name: fn + " blocks"}
+		ext, err := expandFile(qi, src, fn, parent, parentAt, params, &counter)
+		layers = append(layers, src)
+		if err != nil {
+			return &Source{Name: qi.Filename, Layers: layers}, err
+		}
+		if ext == nil {
+			break
+		}
+		fn, parent, parentAt = ext.layout, ext.origin, ext.originAt
+		params = append(ext.params, params...)
+	}
+
+	// The base layout is the template proper; the rest override it,
+	// outermost first.
+	base := layers[len(layers)-1]
+	base.Name = qi.Filename
+	for i := len(layers) - 2; i >= 0; i-- {
+		base.Layers = append(base.Layers, layers[i])
+	}
+	return base, nil
+}
+
+// expandFile expands fn (and everything it PROCESSes or INCLUDEs) into src.
+// Declarations for params are emitted first.  If fn is a page that
+// extends a layout, that is returned for Expand to follow.
+func expandFile(qi *QueueItem, src *Source, top string, topParent *Origin, topParentAt int, params []param, counter *int) (*extension, error) {
+
+	// where describes the PROCESS directive being worked on, for errors.
+	where := func(fn string, parent *Origin, parentAt int) string {
+		if parent == nil {
+			return qi.RootDir + "/" + fn
+		}
+		return parent.Describe(parentAt)
+	}
+
+	maxDepth := maxIncludeDepth(qi)
+	var ext *extension
+
+	// INCLUDEs become named templates, defined after the main text.
+	type deferred struct {
+		name     string
+		fn       string
+		params   []param
+		parent   *Origin
+		parentAt int
+	}
+	includes := []deferred{}
+
+	var expand func(fn string, parent *Origin, parentAt int) error
+	expand = func(fn string, parent *Origin, parentAt int) error {
+		fullname, dir, err := resolveInclude(qi, fn)
+		if err != nil {
+			return fmt.Errorf("%s: %v", where(fn, parent, parentAt), err)
+		}
+		if err := checkInclude(parent, fullname, fn, maxDepth); err != nil {
+			return fmt.Errorf("%s: %v", where(fn, parent, parentAt), err)
+		}
+
+		content, err := qi.Files.ReadFile(fullname)
+		if err != nil {
+			return fmt.Errorf("tried to load %s (via %s): %s", fullname, where(fn, parent, parentAt), err)
+		}
+		if qi.PoFile.Language == "en_US" {
+			UpdatePot(qi, content, fn)
+		}
+
+		origin := &Origin{
+			File:     fn,
+			Path:     fullname,
+			Content:  content,
+			Parent:   parent,
+			ParentAt: parentAt,
+		}
+		if dir != qi.RootDir {
+			origin.Dir = dir
+		}
+		src.Origins = append(src.Origins, origin)
+
+		// Is this a page built on a layout?
+		last := 0
+		for _, m := range reEXTENDS.FindAllStringSubmatchIndex(content, -1) {
+			if fn != top || ext != nil || strings.TrimSpace(content[:m[0]]) != "" {
+				return fmt.Errorf("%s: extends must be the first thing in a page", origin.Describe(m[0]))
+			}
+			p, err := parseParams(content[m[4]:m[5]])
+			if err != nil {
+				return fmt.Errorf("%s: %v", origin.Describe(m[0]), err)
+			}
+			ext = &extension{layout: content[m[2]:m[3]], params: p, origin: origin, originAt: m[0]}
+			last = m[1]
+		}
+
+		// Do we see PROCESS or INCLUDE lines?
+		for _, m := range rePROCESS.FindAllStringSubmatchIndex(content, -1) {
+			if m[0] < last {
+				continue
+			}
+			src.appendText(content[last:m[0]], origin, last)
+			last = m[1]
+
+			keyword, inside := content[m[2]:m[3]], content[m[4]:m[5]]
+			params, err := parseParams(content[m[6]:m[7]])
+			if err != nil {
+				return fmt.Errorf("%s: %v", origin.Describe(m[0]), err)
+			}
+
+			switch {
+			case keyword == "INCLUDE":
+				*counter++
+				name := fmt.Sprintf("INCLUDE %s #%d", inside, *counter)
+				includes = append(includes, deferred{name, inside, params, origin, m[0]})
+				src.appendDirective(fmt.Sprintf(`[%% template %q (includeScope $%s) %%]`, name, scopeArgs(params)), origin, m[0])
+			case len(params) > 0:
+				// Parameters get their own block, so they go out of scope afterwards.
+				src.appendDirective(`[% if true %]`+declareParams(params, false)+lineBreak, origin, m[0])
+				if err := expand(inside, origin, m[0]); err != nil {
+					return err
+				}
+				src.appendDirective(`[% end %]`, origin, m[0])
+			default:
+				if err := expand(inside, origin, m[0]); err != nil {
+					return err
+				}
+			}
+		}
+		src.appendText(content[last:], origin, last)
+		return nil
+	}
+
+	// Parameters passed by a page to its layout.
+	if len(params) > 0 {
+		src.appendDirective(declareParams(params, false)+lineBreak, topParent, topParentAt)
+	}
+	if err := expand(top, topParent, topParentAt); err != nil {
+		return nil, err
+	}
+
+	// INCLUDEd files are parsed as their own templates; they see only
+	// their parameters, and can't touch the caller's variables.
+	for i := 0; i < len(includes); i++ {
+		inc := includes[i]
+		src.appendDirective(fmt.Sprintf(`[%% define %q %%]`, inc.name)+declareParams(inc.params, true)+lineBreak, inc.parent, inc.parentAt)
+		if err := expand(inc.fn, inc.parent, inc.parentAt); err != nil {
+			return nil, err
+		}
+		src.appendDirective(`[% end %]`, inc.parent, inc.parentAt)
+	}
+	src.finish()
+
+	return ext, nil
+}
+
+// maxIncludeDepth returns how deeply PROCESS directives may nest.
+func maxIncludeDepth(qi *QueueItem) int {
+	if qi.Config == nil || qi.Config.Options.MaxIncludeDepth == 0 {
+		return defaultMaxIncludeDepth
+	}
+	return qi.Config.Options.MaxIncludeDepth
+}
+
+// checkInclude makes sure that pulling path into parent would neither
+// loop back on itself, nor nest deeper than max.
+func checkInclude(parent *Origin, path string, name string, max int) error {
+	depth := 0
+	chain := []string{name}
+	for o := parent; o != nil; o = o.Parent {
+		depth++
+		chain = append([]string{o.File}, chain...)
+		if o.Path == path {
+			return fmt.Errorf("include cycle: %s", strings.Join(chain, " -> "))
+		}
+	}
+	if depth > max {
+		return fmt.Errorf("includes nested more than %d deep: %s", max, strings.Join(chain, " -> "))
+	}
+	return nil
+}
+
+// rePARAM matches one name=value parameter of a PROCESS or INCLUDE directive.
+var rePARAM = regexp.MustCompile(`(\w+)\s*=\s*("(?:[^"\\]|\\.)*"|[^\s"%]+)`)
+
+// reBAREVALUE matches the unquoted parameter values we accept:
+// numbers, booleans, $variables and .Fields.
+var reBAREVALUE = regexp.MustCompile(`^(-?[0-9]+(\.[0-9]+)?|true|false|\$\w*(\.\w+)*|(\.\w+)+)$`)
+
+// lineBreak is a template comment holding a newline.  Generated text ends
+// with it, so that the included file starts on a line of its own; that
+// keeps line-only parse errors pointing at the right file.
+const lineBreak = "[%/*\n*/%]"
+
+// param is a single name=value pair.  The value is kept as template
+// syntax, ready to be pasted into a generated directive.
+type param struct {
+	name  string
+	value string
+}
+
+// parseParams splits the parameter text that follows the filename.
+func parseParams(s string) ([]param, error) {
+	params := []param{}
+	for _, m := range rePARAM.FindAllStringSubmatch(s, -1) {
+		name, value := m[1], m[2]
+		if !strings.HasPrefix(value, `"`) && !reBAREVALUE.MatchString(value) {
+			return nil, fmt.Errorf("parameter %s=%s: quote strings, or use a number, $variable or .Field", name, value)
+		}
+		params = append(params, param{name: name, value: value})
+	}
+	return params, nil
+}
+
+// declareParams turns parameters into variable declarations.  Inside an
+// INCLUDE the values come from .Params; otherwise they are used as written.
+func declareParams(params []param, fromScope bool) string {
+	text := ""
+	for _, p := range params {
+		if fromScope {
+			text += fmt.Sprintf(`[%% $%s := index .Params %q %%]`, p.name, p.name)
+		} else {
+			text += fmt.Sprintf(`[%% $%s := %s %%]`, p.name, p.value)
+		}
+	}
+	return text
+}
+
+// scopeArgs renders parameters as the trailing arguments for includeScope.
+func scopeArgs(params []param) string {
+	text := ""
+	for _, p := range params {
+		text += fmt.Sprintf(" %q %s", p.name, p.value)
+	}
+	return text
+}
+
+// includeScope builds the data for an INCLUDEd template from the caller's
+// data (a page, or another INCLUDE) and alternating names and values.
+func includeScope(data interface{}, pairs ...interface{}) (*IncludeScope, error) {
+	scope := &IncludeScope{Params: make(map[string]interface{})}
+	switch d := data.(type) {
+	case *TemplateData:
+		scope.TemplateData = d
+	case *IncludeScope:
+		scope.TemplateData = d.TemplateData
+	default:
+		return nil, fmt.Errorf("includeScope: unexpected data %T", data)
+	}
+	if len(pairs)%2 != 0 {
+		return nil, fmt.Errorf("includeScope: odd number of parameters")
+	}
+	for i := 0; i < len(pairs); i += 2 {
+		name, ok := pairs[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("includeScope: parameter name %v is not a string", pairs[i])
+		}
+		scope.Params[name] = pairs[i+1]
+	}
+	return scope, nil
+}
@@ -2,38 +2,53 @@ package job
 
 import (
 	"bytes"
-	"compress/gzip"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
 	"text/template"
+	"text/template/parse"
 	"time"
 
+	"github.com/falling-sky/builder/assets"
 	"github.com/falling-sky/builder/config"
 	"github.com/falling-sky/builder/fileutil"
 	"github.com/falling-sky/builder/gitinfo"
+	"github.com/falling-sky/builder/manifest"
+	"github.com/falling-sky/builder/minify"
 	"github.com/falling-sky/builder/po"
+	"github.com/falling-sky/builder/precompress"
+	"github.com/falling-sky/builder/process"
+	"github.com/falling-sky/builder/rewrite"
+	"github.com/falling-sky/builder/sites"
+	"github.com/falling-sky/builder/tfuncs"
 )
 
-// rePROCESS matches on   [% PROCESS "filename" %]
-// and captures the entire template directivel as well as the inside filename.
-var rePROCESS = regexp.MustCompile(`\[\%\s*PROCESS\s*"(.*?)"\s*\%\]`)
+// rePROCESS matches on   [% PROCESS "filename" %]  and  [% INCLUDE "filename" %]
+// with optional name=value parameters, and captures the keyword, the inside
+// filename, and the parameter text.
+var rePROCESS = regexp.MustCompile(`\[\%\s*(PROCESS|INCLUDE)\s*"(.*?)"((?:\s+\w+\s*=\s*(?:"(?:[^"\\]|\\.)*"|[^\s"%]+))*)\s*\%\]`)
 var reTRANSLATE = regexp.MustCompile(`(?ms){{(.*?)}}`)
 
-// PostType describes a directory, and how to process it.
+// PostInfoType describes how to process the files matched by a pipeline rule.
 type PostInfoType struct {
 	Directory   string
-	Extension   string
-	PostProcess []string
+	PostProcess []process.Step
+	Minify      []minify.Step // Built-in minifiers, run before PostProcess
 	EscapeQuote bool
 	MultiLocale bool
-	Compress    bool
+	Precompress []string          // Encoders for compressed copies; see package precompress
+	MinSavings  float64           // Fraction a compressed copy must save to be written
+	Fingerprint bool              // Copy outputs to content-hashed names; see fingerprint
+	Rewrite     []rewrite.Rule    // Edits to each variant as it is written; see writeOutput
+	Map         map[string]string // Output names for specific files; checked before Config.Map
 }
 
 // QueueItem represents a single job to be queued, and ran as capacity allows.
@@ -46,6 +61,16 @@ type QueueItem struct {
 	PoFile   *po.File
 	Data     *TemplateData
 	PostInfo PostInfoType
+	Cache    *BuildCache         // Optional; see OpenCache
+	Files    *fileutil.FileCache // Optional; template files are read through it
+	Parsed   *ParsedCacheType    // Optional; expansions shared by a template's jobs
+	Assets   *assets.Manifest    // Where fingerprinted outputs are recorded
+	Report   *Report             // Optional; collects what processors said
+	Manifest *manifest.Manifest  // Optional; where outputs came from
+
+	diagnostics []process.Diagnostic // What its processors said; kept in the cache
+	reads       []string             // Names the include and readFile functions looked up
+	extras      []string             // Files it wrote besides its output, such as a source map; see jobOutputs
 }
 
 // QueueTracker is an object for managing QueueItem jobs.
@@ -54,103 +79,228 @@ type QueueTracker struct {
 	WG      *sync.WaitGroup
 }
 
+// IncludeScope is the data an INCLUDEd template runs against: everything
+// from the page's TemplateData, plus the parameters it was called with.
+type IncludeScope struct {
+	*TemplateData
+	Params map[string]interface{}
+}
+
 // TemplateData is passed when adding the job to the queue.
 // This is used by Go's text/template to extract info before expansion.
 type TemplateData struct {
-	GitInfo      *gitinfo.GitInfo
-	PoMap        po.MapStringFile
-	Locale       string
-	Lang         string
-	LangUC       string
-	Basename     string
-	AddLanguage  string
-	DirSignature string
+	GitInfo          *gitinfo.GitInfo
+	PoMap            po.MapStringFile
+	Locale           string
+	Lang             string
+	LangUC           string
+	Basename         string
+	AddLanguage      string
+	TypeMaps         bool                   // Type maps (.var) are written; see Options.TypeMaps
+	Encodings        []*precompress.Encoder // Compressed copies the pipeline writes, preferred first
+	NginxLanguageMap string                 // Accept-Language to locale, for nginx.conf.example
+	CaddyLanguageMap string                 // The same, for Caddyfile.example
+	DirSignature     string
+	Vars             map[string]interface{} // From the config file
+	Data             map[string]interface{} // From the data directory, for this locale
+	Sites            *sites.List            // Partner sites and mirrors
+	Profile          string                 // Config profile being built, such as "dev"
+	Assets           *assets.Manifest       // Fingerprinted outputs, for the asset function; nil while building them
 }
 
 // ParsedCacheType provides properly mutex locked cache access to
-// the expanded (but untranslated) templates.
+// the expanded (but unexecuted and untranslated) templates.  A nil
+// ParsedCacheType expands every time.
 type ParsedCacheType struct {
 	lock   sync.RWMutex
-	byname map[string]string
+	byname map[string]*Source
+	failed map[string]*Source // What expansions that failed read first
 }
 
-// ParsedCache holds the actual cache of expanded (but not translated) templates.
-var ParsedCache ParsedCacheType
-
-func init() {
-	ParsedCache.byname = make(map[string]string)
+// NewParsedCache returns an empty ParsedCacheType.  Entries depending on
+// files given to files.Changed are dropped.
+func NewParsedCache(files *fileutil.FileCache) *ParsedCacheType {
+	pc := &ParsedCacheType{byname: make(map[string]*Source), failed: make(map[string]*Source)}
+	files.OnChange(pc.Forget)
+	return pc
 }
 
-// GrabContent grabs a file.  Takes into account the QueueItem variables
-// such as the iput directory path.  The file is cached for future requests.
-func GrabContent(qi *QueueItem) string {
-	topName := qi.RootDir + "/" + qi.Filename
-	log.Printf("GrabContent(%s)  (%s)\n", qi.Filename, qi.PoFile.Language)
-
-	grab := func(fn string) string {
-		//		log.Printf("GrabContent(%s)  (%s) (fn=%s)\n", qi.Filename, qi.PoFile.Language, fn)
+// Get returns the expansion of a job's template, expanding it if need be.
+// Failed expansions aren't kept, but the files they read are, so that
+// Dependents knows a fix to any of them is worth a retry.
+func (pc *ParsedCacheType) Get(qi *QueueItem) *Source {
+	if pc == nil {
+		return GrabContent(qi)
+	}
+	readFilename := qi.RootDir + "/" + qi.Filename
+	pc.lock.Lock()
+	defer pc.lock.Unlock()
+	if src, ok := pc.byname[readFilename]; ok {
+		return src
+	}
+	// log.Printf("not cached: %s", readFilename)
+	src, err := grabContent(qi)
+	if err != nil {
+		pc.failed[readFilename] = src
+		fail(err)
+	}
+	delete(pc.failed, readFilename)
+	pc.byname[readFilename] = src
+	return src
+}
 
-		fullname := qi.RootDir + "/" + fn
-		c, err := fileutil.ReadFile(fullname)
-		if err != nil {
-			log.Fatalf("tried to load %s (via %s): %s", fullname, topName, err)
+// Dependents returns the templates (as root/filename) whose expansion
+// read any of paths.
+func (pc *ParsedCacheType) Dependents(paths []string) []string {
+	pc.lock.RLock()
+	defer pc.lock.RUnlock()
+	want := make(map[string]bool)
+	for _, p := range paths {
+		want[p] = true
+	}
+	names := []string{}
+	for _, m := range []map[string]*Source{pc.byname, pc.failed} {
+		for name, src := range m {
+			for _, fn := range src.Files() {
+				if want[fn] {
+					names = append(names, name)
+					break
+				}
+			}
 		}
-		//		log.Printf("read %v (%v bytes)\n", fullname, len(c))
+	}
+	sort.Strings(names)
+	return names
+}
 
-		if qi.PoFile.Language == "en_US" {
-			UpdatePot(qi, c, fn)
-		}
+// Forget drops the expansions that read any of paths.
+func (pc *ParsedCacheType) Forget(paths []string) {
+	names := pc.Dependents(paths)
+	pc.lock.Lock()
+	defer pc.lock.Unlock()
+	for _, name := range names {
+		delete(pc.byname, name)
+		delete(pc.failed, name)
+	}
+}
 
-		return c
+// WriteGraph writes the include tree of every template expanded so far,
+// with the directory each file was resolved from.
+func (pc *ParsedCacheType) WriteGraph(w io.Writer) {
+	pc.lock.RLock()
+	defer pc.lock.RUnlock()
+	names := []string{}
+	for name := range pc.byname {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "# %s\n", name)
+		pc.byname[name].WriteGraph(w)
 	}
+}
 
-	content := grab(qi.Filename)
-	// Do we see PROCESS lines?
-	for {
-		matches := rePROCESS.FindStringSubmatch(content)
-		if len(matches) == 0 {
-			break
-		}
-		if len(matches) < 2 {
-			log.Fatalf("I don't know what happened, but %s is interesting", matches[0])
-		}
-		wrapperString := matches[0]
-		insideName := matches[1]
-		newContent := grab(insideName)
-		content = strings.Replace(content, wrapperString, newContent, -1)
+// GrabContent grabs a file.  Takes into account the QueueItem variables
+// such as the iput directory path.  Any PROCESS directives are expanded
+// in place, recursively; the returned Source remembers which file each
+// part of the text came from.
+func GrabContent(qi *QueueItem) *Source {
+	src, err := grabContent(qi)
+	if err != nil {
+		fail(err)
 	}
-	return content
+	return src
+}
+
+// grabContent is GrabContent, returning the error; see Expand.
+func grabContent(qi *QueueItem) (*Source, error) {
+	log.Printf("GrabContent(%s)  (%s)\n", qi.Filename, qi.PoFile.Language)
+	return Expand(qi)
+}
+
+// KeepGoing makes template errors skip the job, rather than stop the
+// builder.  Watch mode sets it, so that a typo doesn't end the session.
+var KeepGoing bool
+
+// jobFailure carries an error out of a job when KeepGoing is set.
+type jobFailure struct {
+	err error
+}
+
+// fail stops the job with err; see KeepGoing.
+func fail(err error) {
+	if KeepGoing {
+		panic(jobFailure{err})
+	}
+	log.Fatal(err)
 }
 
 // ProcessTemplate runs text.Template against the given text.
 // Note we use [% %]  for text.Template directorives, since these
 // are fewer than translations. And we prefer to do translations
 // without the template ugliness.
-func ProcessTemplate(qi *QueueItem, content string) string {
-	topName := qi.RootDir + "/" + qi.Filename
+func ProcessTemplate(qi *QueueItem, src *Source) string {
+	content, err := Render(qi, src)
+	if err != nil {
+		fail(err)
+	}
+	return content
+}
 
-	// Do we need any custom functions?
-	FuncMap := make(template.FuncMap)
-	FuncMap["EXAMPLE"] = func(name string) (string, error) {
-		//log.Printf("PROCESS: %v\n", name)
-		return "", nil
+// funcOptions sets up the template functions for a job.  Files may be
+// read from anywhere on the job's include path.
+func funcOptions(qi *QueueItem) *tfuncs.Options {
+	o := &tfuncs.Options{Roots: searchPath(qi), Files: qi.Files}
+	if qi.Data != nil && qi.Data.GitInfo != nil {
+		o.Version = qi.Data.GitInfo.Version
+	}
+	if qi.Data != nil && qi.Data.Assets != nil {
+		o.Asset = func(name string) (string, error) {
+			return qi.Data.Assets.URL(name, qi.Data.Locale)
+		}
 	}
+	return o
+}
+
+// Render does the work for ProcessTemplate, returning errors rather
+// than stopping the build.  Errors name the original file and line.
+func Render(qi *QueueItem, src *Source) (string, error) {
+
+	// Functions available to templates; "builder funcs" lists them.
+	o := funcOptions(qi)
+	FuncMap := tfuncs.FuncMap(o)
+	FuncMap["includeScope"] = includeScope
 
 	// Parse the template.  Just looks for markers and implied commands.
 	root := template.New(qi.Filename).Delims(`[%`, `%]`).Funcs(FuncMap)
-	tmpl, err := root.Parse(content)
+	tmpl, err := root.Parse(src.Text)
 	if err != nil {
-		log.Fatalf("Parsing template for %v: %v", topName, err)
+		return "", fmt.Errorf("Parsing template: %v", src.TranslateError(err))
+	}
+
+	// Pages extending a layout are parsed after it, so that their
+	// blocks replace the layout's.  They may hold nothing but blocks.
+	for _, layer := range src.Layers {
+		t, err := tmpl.New(layer.Name).Parse(layer.Text)
+		if err != nil {
+			return "", fmt.Errorf("Parsing template: %v", src.TranslateError(err))
+		}
+		if t.Tree != nil && !parse.IsEmptyTree(t.Tree.Root) {
+			return "", fmt.Errorf("Parsing template: %s extends a layout, so everything in it must be inside a define or block", layer.Origins[0].File)
+		}
 	}
 
-	// Execute the template.
+	// Execute the template.  What the include and readFile functions
+	// read is an input too; see BuildCache.
 	wr := &bytes.Buffer{}
 	err = tmpl.Execute(wr, qi.Data)
+	qi.reads = o.Reads
+	src.noteReads(searchPath(qi), o.Reads)
 	if err != nil {
-		log.Fatalf("Executing template for %v: %v", topName, err)
+		return "", fmt.Errorf("Executing template: %v", src.TranslateError(err))
 	}
 
-	return string(wr.Bytes())
+	return string(wr.Bytes()), nil
 }
 
 func UpdatePot(qi *QueueItem, content string, fn string) {
@@ -202,81 +352,87 @@ func TranslateContent(qi *QueueItem, content string) string {
 	return content
 }
 
-func ProcessContentFancy(qi *QueueItem, content string) {
-
-	tasks := qi.PostInfo.PostProcess
-
-	basename := qi.Filename
+// OutputName is where a template ends up, relative to the output
+// directory, before any locale or .gz is added; see outputNames.
+func OutputName(qi *QueueItem) string {
+	if t, ok := qi.PostInfo.Map[qi.Filename]; ok {
+		return t
+	}
 	if t, ok := qi.Config.Map[qi.Filename]; ok {
-		basename = t
+		return t
 	}
+	return qi.Filename
+}
 
-	// Prepare the macros that we support for running external commands.
-	macros := make(map[string]string)
-	macros["NAME"] = basename
-	macros["NAMEGZ"] = macros["NAME"] + ".gz"
+// outputNames returns the output file, and its gzipped copy, for a job;
+// these are also the [NAME] and [NAMEGZ] processor macros.
+func outputNames(qi *QueueItem) (string, string) {
+	name := OutputName(qi)
+	namegz := name + ".gz"
 	if qi.PostInfo.MultiLocale == true {
-		macros["NAME"] = macros["NAME"] + "." + qi.PoFile.Language
-		macros["NAMEGZ"] = macros["NAMEGZ"] + "." + qi.PoFile.Language
+		name = name + "." + qi.PoFile.Language
+		namegz = namegz + "." + qi.PoFile.Language
 	}
+	return name, namegz
+}
+
+// ProcessContentFancy runs the job's processors over content, and
+// writes what they made.
+func ProcessContentFancy(qi *QueueItem, content string) {
+	outDir := qi.Config.Directories.OutputDir
+
+	// The macros processors may use in their arguments.
+	// NAME or OUTPUT - Final output name, relative to the output directory
+	// NAMEGZ         - Final output name, gzipped
+	// INPUT          - NAME.orig; written for shell commands to read
+	macros := make(map[string]string)
+	macros["NAME"], macros["NAMEGZ"] = outputNames(qi)
 	macros["INPUT"] = macros["NAME"] + ".orig"
 	macros["OUTPUT"] = macros["NAME"]
 
-	// Supported varables are:
-	// INPUT                  - same as [FILENAME].orig - the file written by builder before calling 3rd party fancy tools
-	// FILENAME or OUTPUT     - Final output filename (with path)
-	// FILENAMEGZ or OUTPUTGZ - Final output filename, gzipped (with path)
-	// BASENAME               - Final output name (no path). Use this if inserting text into files.
-	// BASENAMEGZ             - Final output name, gzipped (no path).  Use this if inserting text into files.
-
-	fixup := func(s string) string {
-		for k, v := range macros {
-			kk := "[" + k + "]"
-			s = strings.Replace(s, kk, v, -1)
-		}
-		return s
+	// Clear out compressed copies, so that we can tell which ones the
+	// processors write.
+	for _, name := range outputFiles(qi)[1:] {
+		os.Remove(filepath.Join(outDir, name))
 	}
 
-	// First, write the file to disk.
-	outputfilename := qi.Config.Directories.OutputDir + "/" + macros["INPUT"]
-	os.MkdirAll(filepath.Dir(outputfilename), 0755)
-
-	err := ioutil.WriteFile(outputfilename, []byte(content), 0755)
+	out, err := process.Run(qi.PostInfo.PostProcess, &process.Input{
+		Name:    macros["NAME"],
+		Dir:     outDir,
+		Content: []byte(content),
+		Macros:  macros,
+	})
+	qi.Report.Add(qi, out.Diagnostics)
+	qi.diagnostics = out.Diagnostics
 	if err != nil {
-		log.Fatal(err)
-	}
-	// log.Printf("wrote %s etc (%v bytes)\n", outputfilename, len(content))
-
-	// Post processing defined from the config file, 3rd party tools
-	for _, task := range tasks {
-		runcmd := fixup(task)
-		//log.Printf("running: %s\n", runcmd)
-
-		shellscript := bytes.NewBufferString(runcmd)
-		stderr := &bytes.Buffer{}
-
-		c := exec.Cmd{}
-		c.Path = "/bin/sh"
-		c.Dir = qi.Config.Directories.OutputDir
-		c.Stdin = shellscript
-		c.Stderr = stderr
-		// log.Printf("About to run: %#v\n", runcmd)
-		e := c.Run()
-
-		// HACK HACK HACK ignore tidy exit code 1
-		if e != nil {
-			if strings.HasPrefix(runcmd, "tidy ") {
-				if e.Error() == "exit status 1" {
-					e = nil
-				}
-			}
-		}
-		if e != nil {
-			log.Printf("stderr: %s\n", stderr.String())
-			log.Fatalf("While running %#v .. got: %#v\n", runcmd, e.Error())
+		fail(fmt.Errorf("%s: %v", jobID(qi), err))
+	}
+	for name, b := range out.Files {
+		qi.extras = append(qi.extras, name)
+		fn := filepath.Join(outDir, name)
+		os.MkdirAll(filepath.Dir(fn), 0755)
+		if err := ioutil.WriteFile(fn, b, 0644); err != nil {
+			fail(err)
 		}
 	}
 
+	// A shell step may leave a source map beside the output, as
+	// uglifyjs does; it's part of the job's output too.
+	if _, err := os.Stat(filepath.Join(outDir, macros["NAME"]+".map")); err == nil {
+		qi.extras = append(qi.extras, macros["NAME"]+".map")
+	}
+
+	// Write the processed output, then compress whatever the
+	// processors didn't.
+	processed := string(out.Content)
+	writeOutput(qi, processed)
+	keep := make(map[string]bool)
+	for _, name := range outputFiles(qi)[1:] {
+		if _, err := os.Stat(filepath.Join(outDir, name)); err == nil {
+			keep[name] = true
+		}
+	}
+	precompressOutput(qi, processed, keep)
 }
 
 func ProcessContent(qi *QueueItem, content string) {
@@ -288,52 +444,21 @@ func ProcessContent(qi *QueueItem, content string) {
 		return
 	}
 
-	basename := qi.Filename
-	if t, ok := qi.Config.Map[qi.Filename]; ok {
-		basename = t
-	}
-
 	// Otherwise, do writes directly, and do our own compression.
-	uncompressed := qi.Config.Directories.OutputDir + "/" + basename
-	compressed := qi.Config.Directories.OutputDir + "/" + basename + ".gz"
-	if qi.PostInfo.MultiLocale == true {
-		uncompressed = uncompressed + "." + qi.PoFile.Language
-		compressed = compressed + "." + qi.PoFile.Language
-	}
-
-	// Make sure the directory exists.
-	// We may need to keep track of this;
-	// do we really want to do this 1000+ times?
-	os.MkdirAll(filepath.Dir(uncompressed), 0755)
+	writeOutput(qi, content)
+	precompressOutput(qi, content, nil)
+}
 
-	err := ioutil.WriteFile(uncompressed, []byte(content), 0644)
-	if err != nil {
-		log.Fatal(err)
+// fingerprint copies a job's outputs to content-hashed names, and
+// records them for the asset template function.
+func fingerprint(qi *QueueItem) {
+	if !qi.PostInfo.Fingerprint || qi.Assets == nil {
+		return
 	}
-	// log.Printf("wrote %s etc (%v bytes)\n", outputfilename, len(content))
-
-	if qi.PostInfo.Compress {
-		if strings.HasSuffix(qi.Filename, ".html") {
-			content = strings.Replace(content, `src="/index.js`, `src="/index.js.gz`, -1)
-			content = strings.Replace(content, `href="/index.css`, `href="/index.css.gz`, -1)
-		}
-
-		// Compress in memory
-		b := &bytes.Buffer{}
-		w, err := gzip.NewWriterLevel(b, gzip.BestCompression)
-		if err != nil {
-			log.Fatal(err)
-		}
-		w.Write([]byte(content))
-		w.Close()
-
-		// And write
-		err = ioutil.WriteFile(compressed, b.Bytes(), 0644)
-		if err != nil {
-			log.Fatal(err)
-		}
+	files := outputFiles(qi)
+	if err := qi.Assets.Add(qi.Config.Directories.OutputDir, files[0], files[1:]...); err != nil {
+		fail(err)
 	}
-
 }
 
 // RunJob takes a single QueueItem, and expands, translates, optimizes,
@@ -350,25 +475,54 @@ func RunJob(qi *QueueItem) {
 		}
 	}()
 	// log.Printf("RunJob Filename=%s PoLang=%s\n", qi.Filename, qi.PoFile.Language)
-	readFilename := qi.RootDir + "/" + qi.Filename
 
-	var content string
-	ParsedCache.lock.Lock()
-	if c, ok := ParsedCache.byname[readFilename]; ok {
-		// log.Printf("cached: %s", readFilename)
-		content = c
-	} else {
-		// log.Printf("not cached: %s", readFilename)
-		content = GrabContent(qi)
-		content = ProcessTemplate(qi, content)
-		ParsedCache.byname[readFilename] = content
+	// Expansion is the same for every locale; execution is not,
+	// since TemplateData carries the locale.
+	src := qi.Parsed.Get(qi)
+
+	// Unchanged since the last build?  Then the cache has the output.
+	var key string
+	var parts map[string]string
+	if qi.Cache != nil {
+		var hit bool
+		hit, key, parts = qi.Cache.Restore(qi, src)
+		if hit {
+			fingerprint(qi)
+			recordOutputs(qi, src)
+			return
+		}
 	}
-	ParsedCache.lock.Unlock()
+
+	content := ProcessTemplate(qi, src)
 
 	// TODO process translations
 	content = TranslateContent(qi, content)
+	content = minifyContent(qi, content)
 	ProcessContent(qi, content)
+	fingerprint(qi)
+	recordOutputs(qi, src)
+
+	if qi.Cache != nil {
+		if err := qi.Cache.Save(qi, key, parts); err != nil {
+			log.Printf("cache: %s: %v\n", jobID(qi), err)
+		}
+	}
+
+}
 
+// runJobRecover runs a job, logging (rather than dying of) the errors
+// that KeepGoing lets through.
+func runJobRecover(qi *QueueItem) {
+	defer func() {
+		if r := recover(); r != nil {
+			f, ok := r.(jobFailure)
+			if !ok {
+				panic(r)
+			}
+			log.Printf("%s: %v\n", jobID(qi), f.err)
+		}
+	}()
+	RunJob(qi)
 }
 
 // RunQueue is a goroutine that listens to a channel for jobs.
@@ -377,8 +531,8 @@ func (qt *QueueTracker) RunQueue() {
 	for {
 		job, ok := <-qt.Channel
 		if ok {
-			RunJob(job)  // Run the job.
-			qt.WG.Done() // Decrement WaitGroup counter
+			runJobRecover(job) // Run the job.
+			qt.WG.Done()       // Decrement WaitGroup counter
 		} else {
 			return
 		}
@@ -391,6 +545,12 @@ func (qt *QueueTracker) Add(qi *QueueItem) {
 	qt.Channel <- qi // Put the job in the queue.
 }
 
+// Stop ends the queue's goroutines, once the jobs already added are done.
+// Nothing may be added after.
+func (qt *QueueTracker) Stop() {
+	close(qt.Channel)
+}
+
 // Wait will wait for all existing jobs to finish.
 func (qt *QueueTracker) Wait() {
 	log.Printf("WAITING\n")
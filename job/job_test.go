@@ -0,0 +1,305 @@
+package job
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/falling-sky/builder/config"
+	"github.com/falling-sky/builder/fileutil"
+	"github.com/falling-sky/builder/po"
+)
+
+// writeTree creates a scratch template directory from a map of name to content.
+func writeTree(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "job_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		fn := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(fn), 0755)
+		if err := ioutil.WriteFile(fn, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func testItem(dir string, filename string) *QueueItem {
+	return &QueueItem{
+		RootDir:  dir,
+		Filename: filename,
+		PoFile:   &po.File{Language: "fr_FR"},
+		Data:     &TemplateData{Locale: "fr_FR"},
+	}
+}
+
+func TestGrabContentTrace(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"index.html":        "line one\nline two\n[% PROCESS \"main/tabs.inc\" %]\nafter\n",
+		"main/tabs.inc":     "tabs\n[% PROCESS \"main/tab_tech.inc\" %]\n",
+		"main/tab_tech.inc": "tech one\ntech two\n[% .Nope %]\n",
+	})
+	defer os.RemoveAll(dir)
+
+	src := GrabContent(testItem(dir, "index.html"))
+	if !strings.Contains(src.Text, "tech two") || strings.Contains(src.Text, "PROCESS") {
+		t.Fatalf("unexpected expansion: %q", src.Text)
+	}
+
+	offset := strings.Index(src.Text, "[% .Nope")
+	got := src.Describe(offset)
+	want := "main/tab_tech.inc:3 (included from main/tabs.inc:2 from index.html:3)"
+	if got != want {
+		t.Errorf("Describe: got %q, want %q", got, want)
+	}
+
+	offset = strings.Index(src.Text, "after")
+	if got, want := src.Describe(offset), "index.html:4"; got != want {
+		t.Errorf("Describe: got %q, want %q", got, want)
+	}
+}
+
+func TestTranslateError(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"index.html":  "one\n[% PROCESS \"inc/bad.inc\" %]\n",
+		"inc/bad.inc": "fine\n[% if %]\n",
+	})
+	defer os.RemoveAll(dir)
+
+	src := GrabContent(testItem(dir, "index.html"))
+	_, err := template.New("index.html").Delims(`[%`, `%]`).Parse(src.Text)
+	if err == nil {
+		t.Fatal("expected a parse error")
+	}
+	got := src.TranslateError(err).Error()
+	want := "inc/bad.inc:2 (included from index.html:2): "
+	if !strings.HasPrefix(got, want) {
+		t.Errorf("TranslateError: got %q, want prefix %q", got, want)
+	}
+}
+
+func TestExpandRefusals(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"loop.html":   "[% PROCESS \"inc/a.inc\" %]",
+		"inc/a.inc":   "a\n[% PROCESS \"inc/b.inc\" %]",
+		"inc/b.inc":   "b\n[% PROCESS \"inc/a.inc\" %]",
+		"escape.html": "[% PROCESS \"../../../etc/passwd\" %]",
+		"deep.html":   "[% PROCESS \"inc/d1.inc\" %]",
+		"inc/d1.inc":  "[% PROCESS \"inc/d2.inc\" %]",
+		"inc/d2.inc":  "[% PROCESS \"inc/d3.inc\" %]",
+		"inc/d3.inc":  "bottom",
+	})
+	defer os.RemoveAll(dir)
+
+	var table = []struct {
+		file string
+		want string
+	}{
+		{"loop.html", "include cycle: inc/a.inc -> inc/b.inc -> inc/a.inc"},
+		{"escape.html", "outside of"},
+		{"deep.html", "nested more than 2 deep"},
+	}
+	for _, tt := range table {
+		qi := testItem(dir, tt.file)
+		qi.Config = &config.Record{}
+		qi.Config.Options.MaxIncludeDepth = 2
+		_, err := Expand(qi)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got %v, want error containing %q", tt.file, err, tt.want)
+		}
+	}
+}
+
+func TestExpandSharedDirs(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"html/index.html":   "[% PROCESS \"../shared/banner.inc\" %]",
+		"shared/banner.inc": "banner",
+	})
+	defer os.RemoveAll(dir)
+
+	qi := testItem(dir+"/html", "index.html")
+	qi.Config = &config.Record{}
+	if _, err := Expand(qi); err == nil {
+		t.Fatal("expected shared/ to be refused before being allowed")
+	}
+	qi.Config.Directories.SharedDirs = []string{dir + "/shared"}
+	src, err := Expand(qi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if src.Text != "banner" {
+		t.Errorf("got %q", src.Text)
+	}
+}
+
+func TestExpandSearchPath(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"html/index.html":   "[% PROCESS \"banner.inc\" %] [% PROCESS \"local.inc\" %] [% PROCESS \"site.inc\" %]",
+		"html/local.inc":    "local",
+		"shared/banner.inc": "shared-banner",
+		"shared/local.inc":  "shared-local",
+		"site/banner.inc":   "site-banner",
+		"site/site.inc":     "site-only",
+	})
+	defer os.RemoveAll(dir)
+
+	qi := testItem(dir+"/html", "index.html")
+	qi.Config = &config.Record{}
+	qi.Config.Directories.SharedDirs = []string{dir + "/shared"}
+	qi.Config.Directories.OverrideDir = dir + "/site"
+	src, err := Expand(qi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "shared-banner local site-only"; src.Text != want {
+		t.Errorf("got %q, want %q", src.Text, want)
+	}
+	if got := len(src.Files()); got != 4 {
+		t.Errorf("got %v files, want 4", got)
+	}
+
+	b := &bytes.Buffer{}
+	src.WriteGraph(b)
+	if want := "  banner.inc [" + dir + "/shared]\n"; !strings.Contains(b.String(), want) {
+		t.Errorf("graph missing %q:\n%s", want, b.String())
+	}
+}
+
+func TestProcessParams(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"index.html":  `[% $page := "index" %][% PROCESS "nav.inc" page="faq" tabbed=1 %]|[% $page %]`,
+		"nav.inc":     `[% $page %]/[% $tabbed %]`,
+		"scoped.html": `[% $page := "index" %][% INCLUDE "inc.inc" page="faq" n=$page %]|[% $page %]`,
+		"inc.inc":     `[% $page %]/[% $n %]/[% .Locale %][% $page = "clobbered" %]`,
+		"leak.html":   `[% $secret := 1 %][% INCLUDE "leak.inc" %]`,
+		"leak.inc":    `[% $secret %]`,
+	})
+	defer os.RemoveAll(dir)
+
+	var table = []struct {
+		file string
+		want string
+	}{
+		{"index.html", "faq/1|index"},
+		{"scoped.html", "faq/index/fr_FR|index"},
+	}
+	for _, tt := range table {
+		qi := testItem(dir, tt.file)
+		got, err := Render(qi, GrabContent(qi))
+		if err != nil {
+			t.Errorf("%s: %v", tt.file, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.file, got, tt.want)
+		}
+	}
+
+	qi := testItem(dir, "leak.html")
+	_, err := Render(qi, GrabContent(qi))
+	if err == nil || !strings.Contains(err.Error(), "leak.inc:1 (included from leak.html:1)") {
+		t.Errorf("expected INCLUDE to hide caller variables, got %v", err)
+	}
+}
+
+func TestExtends(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"layouts/page.html": "<title>[% block \"title\" . %]Default[% end %]</title>[% $page %]\n[% PROCESS \"nav.inc\" %]\n[% block \"content\" . %][% end %]",
+		"nav.inc":           "nav=[% $page %]",
+		"index.html":        "[% extends \"layouts/page.html\" page=\"index\" %]\n[% define \"title\" %]Home[% end %]\n[% define \"content\" %]hello [% .Locale %][% end %]\n",
+		"copy.html":         "[% extends \"index.html\" %]\n",
+		"stray.html":        "[% extends \"layouts/page.html\" page=\"x\" %]\nstray text\n",
+		"late.html":         "text\n[% extends \"layouts/page.html\" %]\n",
+		"broken.html":       "[% extends \"layouts/page.html\" page=\"x\" %]\n[% define \"content\" %]\n\n[% .Nope.Nope %][% end %]\n",
+	})
+	defer os.RemoveAll(dir)
+
+	var table = []struct {
+		file string
+		want string
+	}{
+		{"index.html", "<title>Home</title>index\nnav=index\nhello fr_FR"},
+		{"copy.html", "<title>Home</title>index\nnav=index\nhello fr_FR"},
+	}
+	for _, tt := range table {
+		qi := testItem(dir, tt.file)
+		got, err := Render(qi, GrabContent(qi))
+		if err != nil {
+			t.Errorf("%s: %v", tt.file, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.file, got, tt.want)
+		}
+	}
+
+	qi := testItem(dir, "stray.html")
+	if _, err := Render(qi, GrabContent(qi)); err == nil || !strings.Contains(err.Error(), "must be inside a define") {
+		t.Errorf("stray.html: got %v", err)
+	}
+	qi = testItem(dir, "late.html")
+	if _, err := Expand(qi); err == nil || !strings.Contains(err.Error(), "must be the first thing") {
+		t.Errorf("late.html: got %v", err)
+	}
+	qi = testItem(dir, "broken.html")
+	if _, err := Render(qi, GrabContent(qi)); err == nil || !strings.HasPrefix(err.Error(), "Executing template: broken.html:4:") {
+		t.Errorf("broken.html: got %v", err)
+	}
+}
+
+// TestParsedCacheDependents checks that a template is found by the files
+// it read, whether its expansion failed or it read them while rendering.
+func TestParsedCacheDependents(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"html/index.html": `[% PROCESS "a.inc" %][% include "note.txt" %]`,
+		"html/a.inc":      `[% PROCESS "b.inc" x=bare-word %]`,
+		"html/b.inc":      "b",
+		"html/note.txt":   "note",
+	})
+	defer os.RemoveAll(dir)
+	files := fileutil.NewFileCache()
+	pc := NewParsedCache(files)
+	qi := testItem(dir+"/html", "index.html")
+	qi.Files, qi.Parsed = files, pc
+	real := func(name string) string {
+		fn, _ := fileutil.RealPath(filepath.Join(dir, "html", name))
+		return fn
+	}
+	get := func() (src *Source, err error) {
+		KeepGoing = true
+		defer func() {
+			KeepGoing = false
+			if r := recover(); r != nil {
+				err = r.(jobFailure).err
+			}
+		}()
+		return pc.Get(qi), nil
+	}
+
+	if _, err := get(); err == nil {
+		t.Fatal("expected a parameter error")
+	}
+	if got := pc.Dependents([]string{real("a.inc")}); len(got) != 1 {
+		t.Errorf("failed expansion: dependents %v", got)
+	}
+
+	ioutil.WriteFile(real("a.inc"), []byte(`[% PROCESS "b.inc" %]`), 0644)
+	files.Changed(real("a.inc"))
+	src, err := get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := pc.Dependents([]string{real("note.txt")}); len(got) != 0 {
+		t.Errorf("before rendering: dependents %v", got)
+	}
+	ProcessTemplate(qi, src)
+	if got := pc.Dependents([]string{real("note.txt")}); len(got) != 1 {
+		t.Errorf("after rendering: dependents %v", got)
+	}
+}
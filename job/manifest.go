@@ -0,0 +1,93 @@
+package job
+
+import (
+	"path/filepath"
+	"sort"
+
+	"github.com/falling-sky/builder/assets"
+	"github.com/falling-sky/builder/manifest"
+	"github.com/falling-sky/builder/precompress"
+)
+
+// recordOutputs tells the build manifest where each of a job's outputs
+// came from: the template, what it included, and what it was run
+// through.  Fingerprinted copies count as outputs too.
+func recordOutputs(qi *QueueItem, src *Source) {
+	if qi.Manifest == nil {
+		return
+	}
+	names, err := jobOutputs(qi)
+	if err != nil {
+		fail(err)
+	}
+
+	origin := manifest.Origin{
+		ContentType: manifest.ContentType(OutputName(qi)),
+		Template:    qi.PostInfo.Directory + "/" + qi.Filename,
+		Includes:    includes(qi, src),
+		Processors:  []string{},
+	}
+	if qi.PostInfo.MultiLocale {
+		origin.Locale = qi.PoFile.GetLocale()
+	}
+	for i := range qi.PostInfo.Minify {
+		origin.Processors = append(origin.Processors, "minify "+qi.PostInfo.Minify[i].String())
+	}
+	for i := range qi.PostInfo.PostProcess {
+		origin.Processors = append(origin.Processors, qi.PostInfo.PostProcess[i].String())
+	}
+
+	// Compressed copies have the output's type, with an encoding; other
+	// files beside it (such as source maps) are typed by their names.
+	encodings := make(map[string]string)
+	for _, e := range precompress.All() {
+		encodings[encodedName(qi, e)] = e.Name
+	}
+	name, _ := outputNames(qi)
+	for _, rel := range names {
+		o := origin
+		switch enc, ok := encodings[rel]; {
+		case ok:
+			o.Encoding = enc
+		case rel != name:
+			o.ContentType = manifest.ContentType(rel)
+		}
+		qi.Manifest.Record(rel, o)
+
+		// See fingerprint.
+		if !qi.PostInfo.Fingerprint || qi.Assets == nil || rel != name && o.Encoding == "" {
+			continue
+		}
+		if sum, ok := qi.Assets.Sum(name); ok {
+			qi.Manifest.Record(assets.Hashed(rel, sum), o)
+		}
+	}
+}
+
+// includes lists the template files src read, other than the job's own,
+// relative to TemplateDir; or for those from other include directories,
+// as that directory and name.
+func includes(qi *QueueItem, src *Source) []string {
+	seen := map[string]bool{qi.PostInfo.Directory + "/" + qi.Filename: true}
+	files := []string{}
+	var walk func(s *Source)
+	walk = func(s *Source) {
+		for _, o := range s.Origins {
+			f := filepath.Join(qi.PostInfo.Directory, o.File)
+			if o.Dir != "" {
+				f = filepath.Join(o.Dir, o.File)
+			}
+			f = filepath.ToSlash(f)
+			if !seen[f] {
+				seen[f] = true
+				files = append(files, f)
+			}
+		}
+		for _, layer := range s.Layers {
+			walk(layer)
+		}
+	}
+	walk(src)
+	sort.Strings(files)
+	return files
+}
@@ -0,0 +1,61 @@
+package job
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/falling-sky/builder/assets"
+	"github.com/falling-sky/builder/config"
+	"github.com/falling-sky/builder/manifest"
+	"github.com/falling-sky/builder/minify"
+)
+
+func TestRecordOutputs(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"js/index.js": "[% PROCESS \"inc/a.js\" %]",
+		"js/inc/a.js": strings.Repeat("var a = 1;\n", 100),
+	})
+	defer os.RemoveAll(dir)
+	qi := testItem(dir+"/js", "index.js")
+	qi.Config = &config.Record{}
+	qi.Config.Directories.OutputDir = dir + "/out"
+	qi.PostInfo = PostInfoType{
+		Directory:   "js",
+		MultiLocale: true,
+		Fingerprint: true,
+		Precompress: []string{"gzip"},
+		Minify:      []minify.Step{{Type: "js", SourceMap: true}},
+	}
+	qi.Assets = assets.NewManifest()
+	qi.Manifest = manifest.New()
+
+	RunJob(qi)
+	if err := qi.Manifest.Scan(qi.Config.Directories.OutputDir); err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]manifest.File)
+	for _, f := range qi.Manifest.Files {
+		got[f.Path] = f
+	}
+	sum, _ := qi.Assets.Sum("index.js.fr_FR")
+	for name, want := range map[string][2]string{
+		"index.js.fr_FR":                        {"", "text/javascript; charset=utf-8"},
+		"index.js.gz.fr_FR":                     {"gzip", "text/javascript; charset=utf-8"},
+		"index.js.fr_FR.map":                    {"", "application/json"},
+		assets.Hashed("index.js.gz.fr_FR", sum): {"gzip", "text/javascript; charset=utf-8"},
+	} {
+		f, ok := got[name]
+		if !ok {
+			t.Errorf("%s is missing from %v", name, got)
+			continue
+		}
+		if f.Encoding != want[0] || f.ContentType != want[1] || f.Locale != "fr_FR" || f.Template != "js/index.js" {
+			t.Errorf("%s: %+v", name, f)
+		}
+		if !reflect.DeepEqual(f.Includes, []string{"js/inc/a.js"}) || !reflect.DeepEqual(f.Processors, []string{"minify js sourcemap"}) {
+			t.Errorf("%s: includes %v, processors %v", name, f.Includes, f.Processors)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package job
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/falling-sky/builder/minify"
+)
+
+// minifyContent runs a job's built-in minifiers over its content.  JS
+// source maps are written next to the output, as NAME.map.
+func minifyContent(qi *QueueItem, content string) string {
+	name, _ := outputNames(qi)
+	for i := range qi.PostInfo.Minify {
+		step := &qi.PostInfo.Minify[i]
+		r, err := minify.Run(step, name, content)
+		if err != nil {
+			fail(err)
+		}
+		content = r.Text
+		if r.Map == nil {
+			continue
+		}
+		b, err := r.Map.JSON()
+		if err != nil {
+			fail(err)
+		}
+		qi.extras = append(qi.extras, name+".map")
+		fn := filepath.Join(qi.Config.Directories.OutputDir, name+".map")
+		os.MkdirAll(filepath.Dir(fn), 0755)
+		if err := ioutil.WriteFile(fn, b, 0644); err != nil {
+			fail(err)
+		}
+	}
+	return content
+}
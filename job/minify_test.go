@@ -0,0 +1,33 @@
+package job
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/falling-sky/builder/config"
+	"github.com/falling-sky/builder/minify"
+)
+
+func TestMinifyContent(t *testing.T) {
+	dir := writeTree(t, map[string]string{})
+	defer os.RemoveAll(dir)
+	qi := testItem(dir, "index.js")
+	qi.Config = &config.Record{}
+	qi.Config.Directories.OutputDir = dir
+	qi.PostInfo = PostInfoType{MultiLocale: true, Minify: []minify.Step{{Type: "js", SourceMap: true}}}
+
+	got := minifyContent(qi, "// hello\nvar a = 1;\n")
+	if want := "var a=1;\n//# sourceMappingURL=index.js.fr_FR.map\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "index.js.fr_FR.map"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"file":"index.js.fr_FR"`) {
+		t.Errorf("bad source map: %s", b)
+	}
+}
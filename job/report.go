@@ -0,0 +1,73 @@
+package job
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/falling-sky/builder/process"
+)
+
+// Report collects what processor commands said during a build: their
+// output, and any exit status or failure worth a look.
+type Report struct {
+	lock  sync.Mutex
+	Steps []StepReport
+}
+
+// StepReport is one command's diagnostics, with the job it ran for.
+type StepReport struct {
+	File   string // Template, as directory/file
+	Locale string
+	Cached bool `json:",omitempty"` // Said in an earlier build, whose outputs were reused
+	process.Diagnostic
+}
+
+// NewReport returns an empty Report.
+func NewReport() *Report {
+	return &Report{Steps: []StepReport{}}
+}
+
+// Add records the diagnostics of a job's processors; quiet ones are
+// left out.
+func (r *Report) Add(qi *QueueItem, ds []process.Diagnostic) {
+	r.add(qi, ds, false)
+}
+
+// AddCached records the diagnostics a job's processors gave when its
+// outputs, now restored from the cache, were built.
+func (r *Report) AddCached(qi *QueueItem, ds []process.Diagnostic) {
+	r.add(qi, ds, true)
+}
+
+func (r *Report) add(qi *QueueItem, ds []process.Diagnostic, cached bool) {
+	if r == nil {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, d := range ds {
+		if d.Quiet() {
+			continue
+		}
+		r.Steps = append(r.Steps, StepReport{
+			File:       qi.PostInfo.Directory + "/" + qi.Filename,
+			Locale:     qi.PoFile.GetLocale(),
+			Cached:     cached,
+			Diagnostic: d,
+		})
+	}
+}
+
+// Save writes the report as JSON, sorted by file and locale.
+func (r *Report) Save(fn string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	sort.SliceStable(r.Steps, func(i, j int) bool {
+		a, b := r.Steps[i], r.Steps[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Locale < b.Locale
+	})
+	return writeJSON(fn, r)
+}
@@ -0,0 +1,46 @@
+package job
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/falling-sky/builder/config"
+	"github.com/falling-sky/builder/process"
+)
+
+func TestReport(t *testing.T) {
+	dir := writeTree(t, map[string]string{})
+	defer os.RemoveAll(dir)
+	qi := testItem(dir, "index.html")
+	qi.Config = &config.Record{}
+	qi.Config.Directories.OutputDir = dir
+	qi.PostInfo = PostInfoType{Directory: "html", MultiLocale: true, PostProcess: []process.Step{
+		{Processor: "exec", Args: []string{"cat"}},
+		{Processor: "exec", Args: []string{"sh", "-c", "cat; echo 'line 1: warning' >&2; exit 1"}, ExitCodes: []int{0, 1}},
+	}}
+	qi.Report = NewReport()
+
+	ProcessContent(qi, "<p>hi</p>\n")
+	fn := filepath.Join(dir, "report.json")
+	if err := qi.Report.Save(fn); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r Report
+	if err := json.Unmarshal(b, &r); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Steps) != 1 {
+		t.Fatalf("want just the noisy step, got %s", b)
+	}
+	s := r.Steps[0]
+	if s.File != "html/index.html" || s.Locale != "fr_FR" || s.ExitCode != 1 || s.Stderr != "line 1: warning\n" {
+		t.Errorf("got %+v", s)
+	}
+}
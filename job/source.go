@@ -0,0 +1,283 @@
+package job
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/falling-sky/builder/fileutil"
+)
+
+// reTEMPLATEERROR matches the position prefix text/template puts on
+// parse and execute errors:  template: NAME:LINE: or template: NAME:LINE:COL:
+var reTEMPLATEERROR = regexp.MustCompile(`^template: ([^:]*):(\d+)(?::(\d+))?: `)
+
+// Origin is one file that took part in an expansion, along with
+// where it was pulled in from.
+type Origin struct {
+	File     string  // Name relative to the template root
+	Path     string  // Resolved location on disk
+	Dir      string  // Include path entry it was found in, if not the template root
+	Content  string  // Raw file content, used for line/column lookups
+	Parent   *Origin // Who included us; nil for the top level file
+	ParentAt int     // Offset of the PROCESS directive within Parent
+}
+
+// span maps a run of expanded text back to a region of an Origin.
+type span struct {
+	start  int // Offset in the expanded text
+	end    int
+	origin *Origin
+	offset int  // Offset within origin.Content that start corresponds to
+	fixed  bool // Generated text; all of it maps to offset
+}
+
+// Source is expanded template text (all PROCESS directives pasted in),
+// plus enough bookkeeping to map any offset back to the file, line and
+// column that produced it.
+type Source struct {
+	Name     string
+	Text     string
+	Origins  []*Origin // Every file read, in the order they were first pulled in
+	Layers   []*Source // Pages and layouts extending this one, in the order to parse them
+	spans    []span
+	buf      strings.Builder
+	usesOnce sync.Once
+	uses     *dataUse // See dataUses
+	lock     sync.Mutex
+	reads    map[string]bool // Paths template functions read while rendering; see noteReads
+}
+
+// Position describes a location in one of the original template files.
+type Position struct {
+	File   string
+	Dir    string // Set when File came from a shared or override directory
+	Line   int
+	Column int
+}
+
+func (p Position) String() string {
+	if p.Dir != "" {
+		return fmt.Sprintf("%s:%d [%s]", p.File, p.Line, p.Dir)
+	}
+	return fmt.Sprintf("%s:%d", p.File, p.Line)
+}
+
+// position converts an offset in content to a 1-based line and column.
+func position(o *Origin, offset int) Position {
+	content := o.Content
+	if offset > len(content) {
+		offset = len(content)
+	}
+	before := content[:offset]
+	line := strings.Count(before, "\n") + 1
+	col := offset - (strings.LastIndex(before, "\n") + 1) + 1
+	return Position{File: o.File, Dir: o.Dir, Line: line, Column: col}
+}
+
+// appendText adds a run of text that came from origin, starting at offset.
+func (s *Source) appendText(text string, origin *Origin, offset int) {
+	if text == "" {
+		return
+	}
+	start := s.buf.Len()
+	s.buf.WriteString(text)
+	s.spans = append(s.spans, span{start: start, end: s.buf.Len(), origin: origin, offset: offset})
+}
+
+// appendDirective adds generated text standing in for the directive
+// at offset in origin.  Every position within it maps to the directive.
+func (s *Source) appendDirective(text string, origin *Origin, offset int) {
+	start := s.buf.Len()
+	s.buf.WriteString(text)
+	s.spans = append(s.spans, span{start: start, end: s.buf.Len(), origin: origin, offset: offset, fixed: true})
+}
+
+// finish makes the accumulated text available as s.Text.
+func (s *Source) finish() {
+	s.Text = s.buf.String()
+	s.buf.Reset()
+}
+
+// lookup finds the span holding offset.
+func (s *Source) lookup(offset int) (span, bool) {
+	i := sort.Search(len(s.spans), func(i int) bool {
+		return s.spans[i].end > offset
+	})
+	if i == len(s.spans) {
+		if len(s.spans) == 0 {
+			return span{}, false
+		}
+		i = len(s.spans) - 1
+	}
+	return s.spans[i], true
+}
+
+// Files returns the resolved paths of every file that went into the
+// expansion, and those template functions have read from since.
+func (s *Source) Files() []string {
+	files := []string{}
+	for _, o := range s.Origins {
+		files = append(files, o.Path)
+	}
+	for _, layer := range s.Layers {
+		files = append(files, layer.Files()...)
+	}
+	s.lock.Lock()
+	for fn := range s.reads {
+		files = append(files, fn)
+	}
+	s.lock.Unlock()
+	return files
+}
+
+// noteReads remembers the files that the include and readFile template
+// functions found for names, when rendering for any locale, so that Files
+// lists them too.
+func (s *Source) noteReads(dirs []string, names []string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, name := range names {
+		full, _, err := fileutil.Search(dirs, name)
+		if err != nil {
+			continue
+		}
+		if s.reads == nil {
+			s.reads = make(map[string]bool)
+		}
+		s.reads[full] = true
+	}
+}
+
+// WriteGraph writes the include tree of the expansion, one file per line,
+// indented by depth.  Files found outside the template root say where.
+func (s *Source) WriteGraph(w io.Writer) {
+	for _, o := range s.Origins {
+		depth := 0
+		for p := o.Parent; p != nil; p = p.Parent {
+			depth++
+		}
+		fmt.Fprintf(w, "%s%s", strings.Repeat("  ", depth), o.File)
+		if o.Dir != "" {
+			fmt.Fprintf(w, " [%s]", o.Dir)
+		}
+		fmt.Fprintf(w, "\n")
+	}
+	for _, layer := range s.Layers {
+		layer.WriteGraph(w)
+	}
+}
+
+// Trace returns the chain of positions for an offset in the expanded text.
+// The first entry is the innermost file; the rest are the PROCESS directives
+// that pulled it in, ending with the top level file.
+func (s *Source) Trace(offset int) []Position {
+	sp, ok := s.lookup(offset)
+	if !ok {
+		return []Position{{File: s.Name, Line: 1, Column: 1}}
+	}
+	if sp.fixed {
+		return sp.origin.Trace(sp.offset)
+	}
+	return sp.origin.Trace(sp.offset + (offset - sp.start))
+}
+
+// Trace returns the chain of positions for an offset within this origin,
+// followed by the PROCESS directives that pulled it in.
+func (o *Origin) Trace(at int) []Position {
+	trace := []Position{}
+	for ; o != nil; o = o.Parent {
+		trace = append(trace, position(o, at))
+		at = o.ParentAt
+	}
+	return trace
+}
+
+// Describe renders an offset as "inner.inc:42 (included from outer.inc:7 from index.html:19)"
+func (s *Source) Describe(offset int) string {
+	return describe(s.Trace(offset))
+}
+
+// Describe renders an offset within this origin the same way Source.Describe does.
+func (o *Origin) Describe(at int) string {
+	return describe(o.Trace(at))
+}
+
+func describe(trace []Position) string {
+	text := trace[0].String()
+	for i, p := range trace[1:] {
+		if i == 0 {
+			text += " (included from " + p.String()
+		} else {
+			text += " from " + p.String()
+		}
+	}
+	if len(trace) > 1 {
+		text += ")"
+	}
+	return text
+}
+
+// lineOffset returns the offset of the start of a 1-based line in the expanded text.
+func (s *Source) lineOffset(line int) int {
+	offset := 0
+	for i := 1; i < line; i++ {
+		n := strings.IndexByte(s.Text[offset:], '\n')
+		if n < 0 {
+			return len(s.Text)
+		}
+		offset += n + 1
+	}
+	return offset
+}
+
+// skipGenerated moves offset past generated text, as long as it stays on
+// the same line.  Used when an error names only a line, since the start
+// of that line may be the tail end of a generated directive.
+func (s *Source) skipGenerated(offset int) int {
+	for {
+		sp, ok := s.lookup(offset)
+		if !ok || !sp.fixed || sp.end >= len(s.Text) {
+			return offset
+		}
+		if strings.Contains(s.Text[offset:sp.end], "\n") {
+			return offset
+		}
+		offset = sp.end
+	}
+}
+
+// TranslateError rewrites the line (and column) that text/template reports
+// against the expanded text, so that it names the original file and the
+// include chain instead.  Errors it doesn't recognize are returned as-is.
+func (s *Source) TranslateError(err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+	m := reTEMPLATEERROR.FindStringSubmatchIndex(msg)
+	if m == nil {
+		return err
+	}
+
+	// Errors from a layer carry that layer's name.
+	for _, layer := range s.Layers {
+		if layer.Name == msg[m[2]:m[3]] {
+			s = layer
+		}
+	}
+
+	line, _ := strconv.Atoi(msg[m[4]:m[5]])
+	offset := s.lineOffset(line)
+	if m[6] >= 0 {
+		col, _ := strconv.Atoi(msg[m[6]:m[7]])
+		offset += col
+	} else {
+		offset = s.skipGenerated(offset)
+	}
+	return fmt.Errorf("%s: %s", s.Describe(offset), msg[m[1]:])
+}
@@ -0,0 +1,190 @@
+// Package manifest records what a build wrote: every file in the output
+// directory, with its checksum, size and type, and for template outputs
+// where it came from.  Mirrors and deploy scripts use it to verify a
+// copy, and to sync only what changed.
+package manifest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/falling-sky/builder/gitinfo"
+)
+
+// Name is the manifest's file name in the output directory.
+const Name = "manifest.json"
+
+// Manifest is the build, and the files it wrote.
+type Manifest struct {
+	Build   Build
+	Files   []File
+	lock    sync.Mutex
+	origins map[string]Origin
+}
+
+// Build describes the build as a whole.
+type Build struct {
+	GitInfo        *gitinfo.GitInfo // The site's checkout
+	ConfigSHA256   string           // Of the config in effect, defaults and overrides included
+	BuilderVersion string           // As set at link time; "devel" if not
+	BuilderSHA256  string           // Of the builder executable
+	Started        time.Time
+	Finished       time.Time
+	Seconds        float64
+}
+
+// File is one file in the output directory.
+type File struct {
+	Path        string // Relative to the output directory, with forward slashes
+	SHA256      string
+	Size        int64
+	ContentType string
+	Locale      string   `json:",omitempty"`
+	Encoding    string   `json:",omitempty"` // Content-Encoding, such as gzip or br
+	Template    string   `json:",omitempty"` // As directory/file, for template outputs
+	Includes    []string `json:",omitempty"` // Every other template file it read
+	Processors  []string `json:",omitempty"` // The steps it was run through, in order
+}
+
+// Origin is what a job knows about one of the files it wrote.
+type Origin struct {
+	ContentType string // If empty, worked out from the name or content
+	Locale      string
+	Encoding    string
+	Template    string
+	Includes    []string
+	Processors  []string
+}
+
+// New returns an empty Manifest.
+func New() *Manifest {
+	return &Manifest{Files: []File{}, origins: make(map[string]Origin)}
+}
+
+// Record notes where path, relative to the output directory, came from.
+// Recording it again replaces what was known.
+func (m *Manifest) Record(path string, o Origin) {
+	if m == nil {
+		return
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.origins[filepath.ToSlash(path)] = o
+}
+
+// Scan lists every regular file below dir, other than the manifest
+// itself, with what was recorded about it.  Symlinks are left out.
+func (m *Manifest) Scan(dir string) error {
+	files := []File{}
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == Name {
+			return nil
+		}
+		f, err := m.describe(path, rel)
+		if err != nil {
+			return err
+		}
+		files = append(files, *f)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.Files = files
+	return nil
+}
+
+// describe hashes one file, and adds its origin.
+func (m *Manifest) describe(path string, rel string) (*File, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	h := sha256.New()
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(fd, head)
+	h.Write(head[:n])
+	size, err := io.Copy(h, fd)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &File{Path: rel, SHA256: hex.EncodeToString(h.Sum(nil)), Size: int64(n) + size}
+	m.lock.Lock()
+	o, ok := m.origins[rel]
+	m.lock.Unlock()
+	if ok {
+		f.ContentType = o.ContentType
+		f.Locale = o.Locale
+		f.Encoding = o.Encoding
+		f.Template = o.Template
+		f.Includes = o.Includes
+		f.Processors = o.Processors
+	}
+	if f.ContentType == "" {
+		f.ContentType = ContentType(rel)
+	}
+	if f.ContentType == "" {
+		f.ContentType = http.DetectContentType(head[:n])
+	}
+	return f, nil
+}
+
+// types are those the mime package may not know.
+var types = map[string]string{
+	".map": "application/json",
+}
+
+// ContentType is the type for name's extension, or "" if it has none
+// we know.
+func ContentType(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	if t, ok := types[ext]; ok {
+		return t
+	}
+	return mime.TypeByExtension(ext)
+}
+
+// SHA256 hashes b, as the manifest does files.
+func SHA256(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+// Save writes the manifest into dir.
+func (m *Manifest) Save(dir string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	b, err := json.MarshalIndent(m, "", " ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, Name), append(b, '\n'), 0644)
+}
@@ -0,0 +1,84 @@
+package manifest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestScan(t *testing.T) {
+	dir, err := ioutil.TempDir("", "manifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"index.js.fr_FR":    "var a;",
+		"index.js.gz.fr_FR": "zipped",
+		"images/a.png":      "\x89PNG\r\n\x1a\n",
+		"README":            "plain text",
+	}
+	for name, content := range files {
+		fn := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(fn), 0755)
+		if err := ioutil.WriteFile(fn, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.Symlink(".", filepath.Join(dir, "isp"))
+
+	m := New()
+	o := Origin{ContentType: "text/javascript", Locale: "fr_FR", Template: "js/index.js", Includes: []string{"js/inc/a.js"}}
+	m.Record("index.js.fr_FR", o)
+	o.Encoding = "gzip"
+	m.Record("index.js.gz.fr_FR", o)
+	if err := m.Scan(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Save(dir); err != nil {
+		t.Fatal(err)
+	}
+	// Saving again must not list the manifest itself.
+	if err := m.Scan(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]File)
+	for _, f := range m.Files {
+		got[f.Path] = f
+	}
+	if len(got) != len(files) {
+		t.Errorf("got %v files, want %v: %+v", len(got), len(files), m.Files)
+	}
+	want := File{
+		Path:        "index.js.gz.fr_FR",
+		SHA256:      SHA256([]byte("zipped")),
+		Size:        6,
+		ContentType: "text/javascript",
+		Locale:      "fr_FR",
+		Encoding:    "gzip",
+		Template:    "js/index.js",
+		Includes:    []string{"js/inc/a.js"},
+	}
+	if f := got["index.js.gz.fr_FR"]; !reflect.DeepEqual(f, want) {
+		t.Errorf("got %+v, want %+v", f, want)
+	}
+	if f := got["images/a.png"]; f.ContentType != "image/png" || f.Template != "" {
+		t.Errorf("images/a.png: %+v", f)
+	}
+	if f := got["README"]; f.ContentType != "text/plain; charset=utf-8" {
+		t.Errorf("README: %+v", f)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, Name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved Manifest
+	if err := json.Unmarshal(b, &saved); err != nil || len(saved.Files) != len(files) {
+		t.Errorf("saved manifest: %v, %s", err, b)
+	}
+}
@@ -0,0 +1,84 @@
+package minify
+
+import (
+	"fmt"
+	"strings"
+)
+
+// cssTight are the characters whitespace can always go around.  Colons
+// aren't, since "a :hover" and "a:hover" are different selectors; the
+// space after one can still go.
+const cssTight = "{};,>~"
+
+// css drops comments and whitespace from a stylesheet.  Safe keeps
+// license comments (/*! ... */).
+func css(step *Step, name string, text string) (*Result, error) {
+	out := &strings.Builder{}
+	var prev byte
+	space := false
+	semi := false // The last declaration in a block needs no semicolon
+	write := func(s string) {
+		if semi && s != "}" {
+			out.WriteByte(';')
+		}
+		semi = false
+		if s == "" {
+			return
+		}
+		if space && out.Len() > 0 {
+			next := s[0]
+			if strings.IndexByte(cssTight+":(\n", prev) < 0 && strings.IndexByte(cssTight+")!", next) < 0 {
+				out.WriteByte(' ')
+			}
+		}
+		space = false
+		out.WriteString(s)
+		prev = s[len(s)-1]
+	}
+
+	n := len(text)
+	for i := 0; i < n; {
+		c := text[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			space = true
+			i++
+		case c == '/' && i+1 < n && text[i+1] == '*':
+			end := strings.Index(text[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated comment")
+			}
+			comment := text[i : i+2+end+2]
+			if step.Safe && strings.HasPrefix(comment, "/*!") {
+				write(comment)
+				out.WriteByte('\n')
+				prev = '\n'
+			} else {
+				space = true
+			}
+			i += len(comment)
+		case c == '"' || c == '\'':
+			j := i + 1
+			for j < n && text[j] != c {
+				if text[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= n {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			write(text[i : j+1])
+			i = j + 1
+		case c == ';':
+			write("")
+			semi, prev, space = true, ';', false
+			i++
+		default:
+			write(text[i : i+1])
+			i++
+		}
+	}
+	write("")
+	return &Result{Text: out.String()}, nil
+}
@@ -0,0 +1,220 @@
+package minify
+
+import (
+	"fmt"
+	"strings"
+)
+
+// htmlRaw are elements whose contents are copied as they are (unless
+// Safe is off, when scripts and styles are minified in turn).
+var htmlRaw = []string{"pre", "textarea", "script", "style"}
+
+// html drops comments and collapses whitespace.  Safe keeps conditional
+// comments (<!--[if IE]>), and whitespace between tags, which can show
+// between inline elements.  Server side includes (<!--#) are always
+// kept, and so is everything inside <pre> and <textarea>.
+func html(step *Step, name string, text string) (*Result, error) {
+	out := &strings.Builder{}
+	n := len(text)
+	for i := 0; i < n; {
+		c := text[i]
+		switch {
+		case strings.HasPrefix(text[i:], "<!--"):
+			end := strings.Index(text[i+4:], "-->")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated comment")
+			}
+			comment := text[i : i+4+end+3]
+			keep := strings.HasPrefix(comment, "<!--#")
+			if step.Safe && htmlConditional(comment) {
+				keep = true
+			}
+			if keep {
+				out.WriteString(comment)
+			}
+			i += len(comment)
+		case strings.HasPrefix(text[i:], "<![endif]") && step.Safe:
+			// The end of a downlevel-revealed conditional comment.
+			end := strings.IndexByte(text[i:], '>')
+			out.WriteString(text[i : i+end+1])
+			i += end + 1
+		case c == '<' && i+1 < n && (htmlLetter(text[i+1]) || text[i+1] == '/' || text[i+1] == '!'):
+			tag, j := htmlTag(text, i)
+			out.WriteString(tag)
+			i = j
+			elem := htmlName(tag)
+			if !htmlIsRaw(elem) {
+				continue
+			}
+			end := htmlIndexFold(text[i:], "</"+elem)
+			if end < 0 {
+				end = n - i
+			}
+			body, err := htmlRawBody(step, elem, tag, text[i:i+end])
+			if err != nil {
+				return nil, fmt.Errorf("<%s> at byte %v: %v", elem, i, err)
+			}
+			out.WriteString(body)
+			i += end
+		case htmlSpace(c):
+			j := i
+			newline := false
+			for j < n && htmlSpace(text[j]) {
+				if text[j] == '\n' {
+					newline = true
+				}
+				j++
+			}
+			last := byte(0)
+			if out.Len() > 0 {
+				last = out.String()[out.Len()-1]
+			}
+			between := last == '>' && j < n && text[j] == '<'
+			switch {
+			case last == 0 || j == n:
+			case htmlSpace(last):
+				// Left before a comment that was dropped.
+			case between && !step.Safe:
+			case newline:
+				out.WriteByte('\n')
+			default:
+				out.WriteByte(' ')
+			}
+			i = j
+		default:
+			out.WriteByte(c)
+			i++
+		}
+	}
+	return &Result{Text: out.String()}, nil
+}
+
+// htmlRawBody is what becomes of the contents of a raw element.
+func htmlRawBody(step *Step, elem string, tag string, body string) (string, error) {
+	if step.Safe || strings.TrimSpace(body) == "" {
+		return body, nil
+	}
+	var f Func
+	switch elem {
+	case "style":
+		f = css
+	case "script":
+		t := strings.ToLower(htmlAttr(tag, "type"))
+		switch {
+		case t == "" || strings.Contains(t, "javascript") || t == "module":
+			f = js
+		case strings.Contains(t, "json"):
+			f = jsonCompact
+		default:
+			return body, nil
+		}
+	default:
+		return body, nil
+	}
+	r, err := f(step, "", body)
+	if err != nil {
+		return "", err
+	}
+	return r.Text, nil
+}
+
+// htmlConditional is true for comments Internet Explorer looks inside.
+func htmlConditional(comment string) bool {
+	return strings.HasPrefix(comment, "<!--[if") || strings.HasPrefix(comment, "<!--<![endif]")
+}
+
+// htmlTag returns the tag starting at i, with the whitespace between
+// attributes collapsed, and where the text after it starts.
+func htmlTag(text string, i int) (string, int) {
+	b := &strings.Builder{}
+	space := false
+	for j := i; j < len(text); j++ {
+		c := text[j]
+		switch {
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(text[j+1:], c)
+			if end < 0 {
+				end = len(text) - j - 1
+			}
+			if space && !strings.HasSuffix(b.String(), "=") {
+				b.WriteByte(' ')
+			}
+			space = false
+			b.WriteString(text[j : j+1+end+1])
+			j += end + 1
+		case htmlSpace(c):
+			space = true
+		case c == '>':
+			b.WriteByte('>')
+			return b.String(), j + 1
+		default:
+			if space && !(c == '/' && j+1 < len(text) && text[j+1] == '>') && c != '=' && !strings.HasSuffix(b.String(), "=") {
+				b.WriteByte(' ')
+			}
+			space = false
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), len(text)
+}
+
+// htmlName is the lower case element name of an opening tag, or "".
+func htmlName(tag string) string {
+	j := 1
+	for j < len(tag) && htmlLetter(tag[j]) {
+		j++
+	}
+	return strings.ToLower(tag[1:j])
+}
+
+// htmlAttr returns the value of attribute name in tag, if it is there.
+func htmlAttr(tag string, name string) string {
+	lower := strings.ToLower(tag)
+	i := strings.Index(lower, " "+name+"=")
+	if i < 0 {
+		return ""
+	}
+	v := tag[i+len(name)+2:]
+	if v != "" && (v[0] == '"' || v[0] == '\'') {
+		if end := strings.IndexByte(v[1:], v[0]); end >= 0 {
+			return v[1 : end+1]
+		}
+	}
+	end := strings.IndexAny(v, " />")
+	if end < 0 {
+		return v
+	}
+	return v[:end]
+}
+
+func htmlIsRaw(elem string) bool {
+	for _, e := range htmlRaw {
+		if e == elem {
+			return true
+		}
+	}
+	return false
+}
+
+// htmlIndexFold is strings.Index for a lower case sub, ignoring ASCII
+// case in s.
+func htmlIndexFold(s string, sub string) int {
+	for i := 0; i+len(sub) <= len(s); i++ {
+		j := 0
+		for j < len(sub) && (s[i+j] == sub[j] || s[i+j]+'a'-'A' == sub[j] && htmlLetter(s[i+j])) {
+			j++
+		}
+		if j == len(sub) {
+			return i
+		}
+	}
+	return -1
+}
+
+func htmlLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func htmlSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
@@ -0,0 +1,349 @@
+package minify
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Token kinds, as far as spacing and regular expressions care.
+const (
+	jsNone = iota
+	jsWord
+	jsNumber
+	jsString // Also template chunks and regular expressions
+	jsPunct
+)
+
+// jsRestricted are keywords a line break may not follow, because
+// automatic semicolon insertion ends the statement there.
+var jsRestricted = map[string]bool{
+	"return": true, "throw": true, "break": true, "continue": true, "yield": true, "async": true,
+}
+
+// jsBeforeRegexp are keywords after which a slash starts a regular
+// expression, rather than dividing.
+var jsBeforeRegexp = map[string]bool{
+	"return": true, "typeof": true, "instanceof": true, "in": true, "of": true, "new": true,
+	"delete": true, "void": true, "throw": true, "case": true, "do": true, "else": true,
+	"yield": true, "await": true,
+}
+
+// jsMinifier drops comments and whitespace from JavaScript, copying
+// every token as it is.  Without Safe, line breaks are dropped too where
+// automatic semicolon insertion can't have needed them.
+type jsMinifier struct {
+	safe      bool
+	src       string
+	out       strings.Builder
+	gen       position    // Where out ends
+	prev      byte        // Its last byte
+	from      cursor      // Source positions, for the map
+	m         *mapBuilder // nil without a source map
+	last      string
+	lastKind  int
+	space     bool
+	newline   bool
+	templates []int // Brace depth inside each open ${ }
+}
+
+func js(step *Step, name string, text string) (*Result, error) {
+	w := &jsMinifier{safe: step.Safe, src: text, from: cursor{text: text}}
+	if step.SourceMap {
+		w.m = &mapBuilder{}
+	}
+	if err := w.run(); err != nil {
+		return nil, err
+	}
+	r := &Result{Text: w.out.String()}
+	if w.m != nil {
+		base := name
+		if i := strings.LastIndex(name, "/"); i >= 0 {
+			base = name[i+1:]
+		}
+		r.Map = &SourceMap{
+			Version:        3,
+			File:           base,
+			Sources:        []string{base + ".orig"},
+			SourcesContent: []string{text},
+			Names:          []string{},
+			Mappings:       w.m.b.String(),
+		}
+		r.Text += "\n//# sourceMappingURL=" + base + ".map\n"
+	}
+	return r, nil
+}
+
+func (w *jsMinifier) run() error {
+	src := w.src
+	n := len(src)
+	for i := 0; i < n; {
+		c := src[i]
+		switch {
+		case c == '\n' || c == '\r':
+			w.newline = true
+			i++
+		case c == ' ' || c == '\t' || c == '\v' || c == '\f':
+			w.space = true
+			i++
+		case c >= utf8.RuneSelf && jsSpace(src[i:]) != 0:
+			r, size := utf8.DecodeRuneInString(src[i:])
+			if r == '\u2028' || r == '\u2029' {
+				w.newline = true
+			} else {
+				w.space = true
+			}
+			i += size
+		case c == '/' && i+1 < n && src[i+1] == '/':
+			for i < n && src[i] != '\n' && src[i] != '\r' {
+				i++
+			}
+			w.space = true
+		case c == '/' && i+1 < n && src[i+1] == '*':
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				return w.errorAt(i, "unterminated comment")
+			}
+			comment := src[i : i+2+end+2]
+			if w.safe && strings.HasPrefix(comment, "/*!") {
+				w.emitComment(comment, i)
+			} else if strings.ContainsAny(comment, "\n\r") {
+				w.newline = true
+			} else {
+				w.space = true
+			}
+			i += len(comment)
+		case c == '\'' || c == '"':
+			j := i + 1
+			for j < n && src[j] != c {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= n {
+				return w.errorAt(i, "unterminated string")
+			}
+			w.emit(jsString, src[i:j+1], i)
+			i = j + 1
+		case c == '`':
+			j, err := w.template(i)
+			if err != nil {
+				return err
+			}
+			i = j
+		case c == '}' && len(w.templates) > 0 && w.templates[len(w.templates)-1] == 0:
+			w.templates = w.templates[:len(w.templates)-1]
+			j, err := w.template(i)
+			if err != nil {
+				return err
+			}
+			i = j
+		case c == '/' && w.regexpAllowed():
+			j := i + 1
+			inClass := false
+			for ; j < n; j++ {
+				if src[j] == '\\' {
+					j++
+					continue
+				}
+				if src[j] == '\n' || src[j] == '\r' {
+					j = n
+					break
+				}
+				if src[j] == '[' {
+					inClass = true
+				} else if src[j] == ']' {
+					inClass = false
+				} else if src[j] == '/' && !inClass {
+					break
+				}
+			}
+			if j >= n {
+				return w.errorAt(i, "unterminated regular expression")
+			}
+			j++
+			for j < n && jsWordByte(src[j]) {
+				j++
+			}
+			w.emit(jsString, src[i:j], i)
+			i = j
+		case c >= '0' && c <= '9' || c == '.' && i+1 < n && src[i+1] >= '0' && src[i+1] <= '9':
+			hex := c == '0' && i+1 < n && strings.IndexByte("xXbBoO", src[i+1]) >= 0
+			j := i + 1
+			for j < n {
+				d := src[j]
+				if jsWordByte(d) || d == '.' {
+					j++
+				} else if (d == '+' || d == '-') && !hex && (src[j-1] == 'e' || src[j-1] == 'E') {
+					j++
+				} else {
+					break
+				}
+			}
+			w.emit(jsNumber, src[i:j], i)
+			i = j
+		case jsWordByte(c) || c == '\\':
+			j := i + 1
+			for j < n && (jsWordByte(src[j]) || src[j] == '\\') && jsSpace(src[j:]) == 0 {
+				j++
+			}
+			w.emit(jsWord, src[i:j], i)
+			i = j
+		default:
+			j := i + 1
+			if (c == '+' || c == '-') && j < n && src[j] == c {
+				j++
+			}
+			if len(w.templates) > 0 {
+				if c == '{' {
+					w.templates[len(w.templates)-1]++
+				} else if c == '}' {
+					w.templates[len(w.templates)-1]--
+				}
+			}
+			w.emit(jsPunct, src[i:j], i)
+			i = j
+		}
+	}
+	return nil
+}
+
+// template copies a template literal from i, which is its opening
+// backquote, or the brace closing one of its ${ } expressions.  The
+// copy stops at the closing backquote or the next ${.
+func (w *jsMinifier) template(i int) (int, error) {
+	src := w.src
+	for j := i + 1; j < len(src); j++ {
+		switch {
+		case src[j] == '\\':
+			j++
+		case src[j] == '`':
+			w.emit(jsString, src[i:j+1], i)
+			return j + 1, nil
+		case src[j] == '$' && j+1 < len(src) && src[j+1] == '{':
+			w.emit(jsString, src[i:j+2], i)
+			w.last, w.lastKind = "{", jsPunct
+			w.templates = append(w.templates, 0)
+			return j + 2, nil
+		}
+	}
+	return 0, w.errorAt(i, "unterminated template literal")
+}
+
+// regexpAllowed reports whether a slash here starts a regular
+// expression.  Like JSMin, this goes by the token before it.
+func (w *jsMinifier) regexpAllowed() bool {
+	switch w.lastKind {
+	case jsNone:
+		return true
+	case jsWord:
+		return jsBeforeRegexp[w.last]
+	case jsPunct:
+		return w.last != ")" && w.last != "]" && w.last != "++" && w.last != "--"
+	}
+	return false
+}
+
+// emit writes a token, with whatever whitespace must come before it.
+func (w *jsMinifier) emit(kind int, tok string, at int) {
+	if w.out.Len() > 0 && (w.space || w.newline) {
+		if w.newline && !w.join(tok) {
+			w.write("\n")
+		} else if w.needSpace(kind, tok) {
+			w.write(" ")
+		}
+	}
+	w.space, w.newline = false, false
+	if w.m != nil {
+		w.m.add(w.gen, w.from.moveTo(at))
+	}
+	w.write(tok)
+	w.last, w.lastKind = tok, kind
+}
+
+// emitComment keeps a license comment on a line of its own.
+func (w *jsMinifier) emitComment(comment string, at int) {
+	if w.out.Len() > 0 {
+		w.write("\n")
+	}
+	if w.m != nil {
+		w.m.add(w.gen, w.from.moveTo(at))
+	}
+	w.write(comment)
+	w.space, w.newline = false, true
+}
+
+// join reports whether a line break before tok can go.
+func (w *jsMinifier) join(tok string) bool {
+	if w.safe {
+		return false
+	}
+	if w.lastKind == jsWord && jsRestricted[w.last] {
+		return tok == "}" || tok == ";"
+	}
+	if w.lastKind == jsPunct && w.last != ")" && w.last != "]" && w.last != "}" && w.last != "++" && w.last != "--" {
+		return true
+	}
+	return strings.IndexByte("}]),;.?:=<>&|^%*", tok[0]) >= 0
+}
+
+// needSpace reports whether tok would run into the token before it.
+func (w *jsMinifier) needSpace(kind int, tok string) bool {
+	prev := w.prev
+	next := tok[0]
+	switch {
+	case jsWordByte(prev) && (jsWordByte(next) || next == '\\'):
+		return true
+	case prev == next && (prev == '+' || prev == '-'):
+		return true
+	case prev == '/' && (next == '/' || next == '*'):
+		return true
+	case prev == '<' && next == '!':
+		return true
+	case w.lastKind == jsNumber && next == '.':
+		return true
+	}
+	return false
+}
+
+func (w *jsMinifier) write(s string) {
+	w.out.WriteString(s)
+	w.prev = s[len(s)-1]
+	for _, r := range s {
+		switch {
+		case r == '\n':
+			w.gen.line++
+			w.gen.col = 0
+		case r >= 0x10000:
+			w.gen.col += 2
+		default:
+			w.gen.col++
+		}
+	}
+}
+
+func (w *jsMinifier) errorAt(i int, msg string) error {
+	p := (&cursor{text: w.src}).moveTo(i)
+	return fmt.Errorf("line %v: %s", p.line+1, msg)
+}
+
+// jsWordByte is true for bytes of identifiers and numbers.  Bytes of
+// multibyte characters count, except for whitespace; see jsSpace.
+func jsWordByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '$' || c >= utf8.RuneSelf
+}
+
+// jsSpace returns the length of a multibyte whitespace character at the
+// start of s, or 0.
+func jsSpace(s string) int {
+	if len(s) == 0 || s[0] < utf8.RuneSelf {
+		return 0
+	}
+	r, size := utf8.DecodeRuneInString(s)
+	if unicode.IsSpace(r) || r == '\ufeff' {
+		return size
+	}
+	return 0
+}
@@ -0,0 +1,15 @@
+package minify
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// jsonCompact drops the whitespace between JSON tokens.
+func jsonCompact(step *Step, name string, text string) (*Result, error) {
+	b := &bytes.Buffer{}
+	if err := json.Compact(b, []byte(text)); err != nil {
+		return nil, err
+	}
+	return &Result{Text: b.String()}, nil
+}
@@ -0,0 +1,125 @@
+// Package minify shrinks outputs without external tools.  HTML, CSS,
+// JavaScript and JSON are built in; each pipeline rule picks the steps
+// it wants.  Minifiers only drop comments and whitespace, so they never
+// need to understand more of a language than its tokens.
+package minify
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+)
+
+// Step is one minifier in a pipeline rule.
+type Step struct {
+	Type      string // html, css, js or json
+	Safe      bool   // Leave <pre>, conditional comments, license comments and line breaks alone
+	SourceMap bool   // For js: write a source map next to the output, and point the output at it
+}
+
+// Result is what a minifier made of its input.
+type Result struct {
+	Text string
+	Map  *SourceMap // Only when the step asks for one
+}
+
+// Func minifies text; name is the output file, for source maps.
+type Func func(step *Step, name string, text string) (*Result, error)
+
+var funcs = map[string]Func{
+	"html": html,
+	"css":  css,
+	"js":   js,
+	"json": jsonCompact,
+}
+
+// Types lists the minifiers, sorted.
+func Types() []string {
+	names := []string{}
+	for name := range funcs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// String is the step as the arguments of a minify processor step, such
+// as "js safe sourcemap".
+func (s *Step) String() string {
+	str := s.Type
+	if s.Safe {
+		str += " safe"
+	}
+	if s.SourceMap {
+		str += " sourcemap"
+	}
+	return str
+}
+
+// Check makes sure a step can be run.
+func (s *Step) Check() error {
+	if _, ok := funcs[s.Type]; !ok {
+		return fmt.Errorf("unknown Type %q", s.Type)
+	}
+	if s.SourceMap && s.Type != "js" {
+		return fmt.Errorf("SourceMap is only for js, not %s", s.Type)
+	}
+	return nil
+}
+
+// Run minifies text with step, and counts the savings; see Totals.
+func Run(step *Step, name string, text string) (*Result, error) {
+	f, ok := funcs[step.Type]
+	if !ok {
+		return nil, fmt.Errorf("minify: unknown type %q", step.Type)
+	}
+	r, err := f(step, name, text)
+	if err != nil {
+		return nil, fmt.Errorf("minify %s %s: %v", step.Type, name, err)
+	}
+	log.Printf("minify %s %s: %v -> %v bytes\n", step.Type, name, len(text), len(r.Text))
+	addTotal(step.Type, len(text), len(r.Text))
+	return r, nil
+}
+
+// Sizes counts the bytes minifiers were given, and gave back.
+type Sizes struct {
+	Files  int
+	Before int
+	After  int
+}
+
+func (s Sizes) String() string {
+	saved := 0
+	if s.Before > 0 {
+		saved = 100 * (s.Before - s.After) / s.Before
+	}
+	return fmt.Sprintf("%v files, %v -> %v bytes (%v%% smaller)", s.Files, s.Before, s.After, saved)
+}
+
+var totals = struct {
+	lock   sync.Mutex
+	bytype map[string]Sizes
+}{bytype: make(map[string]Sizes)}
+
+func addTotal(name string, before int, after int) {
+	totals.lock.Lock()
+	defer totals.lock.Unlock()
+	s := totals.bytype[name]
+	s.Files++
+	s.Before += before
+	s.After += after
+	totals.bytype[name] = s
+}
+
+// Totals returns the sizes minified so far, by type.
+func Totals() map[string]Sizes {
+	totals.lock.Lock()
+	defer totals.lock.Unlock()
+	m := make(map[string]Sizes)
+	for k, v := range totals.bytype {
+		m[k] = v
+	}
+	return m
+}
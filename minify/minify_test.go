@@ -0,0 +1,199 @@
+package minify
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestJS(t *testing.T) {
+	tests := []struct {
+		in   string
+		safe string
+		full string
+	}{
+		{"var a = 1 ;  // one\nvar b = a + +a;", "var a=1;\nvar b=a+ +a;", "var a=1;var b=a+ +a;"},
+		{"return\nx", "return\nx", "return\nx"},
+		{"a\n++b", "a\n++b", "a\n++b"},
+		{"f(a,\n  b)\n.c()", "f(a,\nb)\n.c()", "f(a,b).c()"},
+		{"x = /[/]\\// . test(s) / 2", "x=/[/]\\//.test(s)/2", "x=/[/]\\//.test(s)/2"},
+		{"if (typeof x === 'a  b') return /re/g", "if(typeof x==='a  b')return/re/g", "if(typeof x==='a  b')return/re/g"},
+		{"s = `a ${ b + `c ${d}` } e`;", "s=`a ${b+`c ${d}`} e`;", "s=`a ${b+`c ${d}`} e`;"},
+		{"/*! keep */\n/* drop */ 1 .toString()", "/*! keep */\n1 .toString()", "1 .toString()"},
+		{"a = b\n/* x\n */\n(c)", "a=b\n(c)", "a=b\n(c)"},
+	}
+	for _, tt := range tests {
+		for _, safe := range []bool{true, false} {
+			want := tt.full
+			if safe {
+				want = tt.safe
+			}
+			r, err := js(&Step{Type: "js", Safe: safe}, "x.js", tt.in)
+			if err != nil {
+				t.Errorf("%q: %v", tt.in, err)
+				continue
+			}
+			if r.Text != want {
+				t.Errorf("%q safe=%v: got %q, want %q", tt.in, safe, r.Text, want)
+			}
+		}
+	}
+
+	if _, err := js(&Step{Type: "js"}, "x.js", "a = 'open\n"); err == nil {
+		t.Error("unterminated string was accepted")
+	}
+}
+
+// TestSourceMap checks that every mapping lands on the same token in
+// the output and the source.
+func TestSourceMap(t *testing.T) {
+	src := "// header\nfunction add (a, b) {\n  return a +\n    b; // sum\n}\n\nvar s = 'ünïcode', t = `x${ add(1, 2) }y`;\n"
+	r, err := js(&Step{Type: "js", SourceMap: true}, "dir/add.js.en_US", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(r.Text, "\n//# sourceMappingURL=add.js.en_US.map\n") {
+		t.Errorf("no sourceMappingURL: %q", r.Text)
+	}
+	b, err := r.Map.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m SourceMap
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.File != "add.js.en_US" || m.SourcesContent[0] != src {
+		t.Errorf("bad map header: %s", b)
+	}
+
+	at := func(text string, line int, col int) string {
+		lines := strings.Split(text, "\n")
+		u := []rune(lines[line])
+		if col > len(u) {
+			t.Fatalf("column %v past the end of %q", col, lines[line])
+		}
+		return string(u[col:])
+	}
+	count := 0
+	genLine, genCol, srcLine, srcCol := 0, 0, 0, 0
+	for _, line := range strings.Split(m.Mappings, ";") {
+		genCol = 0
+		for _, seg := range strings.Split(line, ",") {
+			if seg == "" {
+				continue
+			}
+			v := decodeVLQ(t, seg)
+			genCol += v[0]
+			srcLine += v[2]
+			srcCol += v[3]
+			out := at(r.Text, genLine, genCol)
+			in := at(src, srcLine, srcCol)
+			if out[0] != in[0] {
+				t.Errorf("%v:%v %q maps to %v:%v %q", genLine, genCol, out, srcLine, srcCol, in)
+			}
+			count++
+		}
+		genLine++
+	}
+	if count < 20 {
+		t.Errorf("only %v mappings", count)
+	}
+}
+
+func decodeVLQ(t *testing.T, seg string) []int {
+	v := []int{}
+	n, shift := 0, uint(0)
+	for i := 0; i < len(seg); i++ {
+		d := strings.IndexByte(base64Digits, seg[i])
+		n |= (d & 31) << shift
+		shift += 5
+		if d&32 == 0 {
+			if n&1 == 1 {
+				v = append(v, -(n >> 1))
+			} else {
+				v = append(v, n>>1)
+			}
+			n, shift = 0, 0
+		}
+	}
+	if len(v) != 4 {
+		t.Fatalf("segment %q has %v fields", seg, len(v))
+	}
+	return v
+}
+
+func TestCSS(t *testing.T) {
+	in := "/*! license */\n/* note */\na :hover , b > c {\n  color : red ;\n  width: calc(1px + 2%);\n  content: \"a ; b\" ;\n}\n@media screen and (max-width: 10px) { p { margin: 0 } }\n"
+	safe := "/*! license */\na :hover,b>c{color :red;width:calc(1px + 2%);content:\"a ; b\"}@media screen and (max-width:10px){p{margin:0}}"
+	full := strings.TrimPrefix(safe, "/*! license */\n")
+	for _, tt := range []struct {
+		safe bool
+		want string
+	}{{true, safe}, {false, full}} {
+		r, err := css(&Step{Type: "css", Safe: tt.safe}, "x.css", in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Text != tt.want {
+			t.Errorf("safe=%v: got %q, want %q", tt.safe, r.Text, tt.want)
+		}
+	}
+}
+
+func TestHTML(t *testing.T) {
+	in := `<!DOCTYPE html>
+<html>
+  <!-- note -->
+  <!--#include virtual="/x" -->
+  <!--[if IE 6]><p>old</p><![endif]-->
+  <p  class = "a  b"   id=x >Hello,
+     <b>world</b> </p>
+  <PRE>  keep
+     this  </PRE>
+  <script>
+    var a = 1 ; // one
+  </script>
+</html>
+`
+	safe := `<!DOCTYPE html>
+<html>
+<!--#include virtual="/x" -->
+<!--[if IE 6]><p>old</p><![endif]-->
+<p class="a  b" id=x>Hello,
+<b>world</b> </p>
+<PRE>  keep
+     this  </PRE>
+<script>
+    var a = 1 ; // one
+  </script>
+</html>`
+	full := `<!DOCTYPE html><html><!--#include virtual="/x" --><p class="a  b" id=x>Hello,
+<b>world</b></p><PRE>  keep
+     this  </PRE><script>var a=1;</script></html>`
+	for _, tt := range []struct {
+		safe bool
+		want string
+	}{{true, safe}, {false, full}} {
+		r, err := html(&Step{Type: "html", Safe: tt.safe}, "x.html", in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Text != tt.want {
+			t.Errorf("safe=%v: got\n%s\nwant\n%s", tt.safe, r.Text, tt.want)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	r, err := Run(&Step{Type: "json"}, "x.json", "{ \"a\" : [1, 2] }\n")
+	if err != nil || r.Text != `{"a":[1,2]}` {
+		t.Errorf("json: got %q, %v", r.Text, err)
+	}
+	if s := Totals()["json"]; s.Files != 1 || s.After != 11 {
+		t.Errorf("Totals: %+v", s)
+	}
+	if err := (&Step{Type: "css", SourceMap: true}).Check(); err == nil {
+		t.Error("css source maps passed Check")
+	}
+}
@@ -0,0 +1,106 @@
+package minify
+
+import (
+	"encoding/json"
+	"strings"
+	"unicode/utf8"
+)
+
+// SourceMap is a version 3 source map, taking minified output back to
+// the text the minifier was given.
+type SourceMap struct {
+	Version        int      `json:"version"`
+	File           string   `json:"file"`
+	Sources        []string `json:"sources"`
+	SourcesContent []string `json:"sourcesContent"`
+	Names          []string `json:"names"`
+	Mappings       string   `json:"mappings"`
+}
+
+// JSON returns the map as written to disk.
+func (m *SourceMap) JSON() ([]byte, error) {
+	return json.Marshal(m)
+}
+
+// position is a line and column, both from zero; columns count UTF-16
+// units, as source maps do.
+type position struct {
+	line int
+	col  int
+}
+
+// cursor follows a position through text, which is only ever read
+// forwards.
+type cursor struct {
+	text string
+	at   int
+	pos  position
+}
+
+// moveTo advances the cursor to byte offset i.
+func (c *cursor) moveTo(i int) position {
+	for c.at < i {
+		r, size := utf8.DecodeRuneInString(c.text[c.at:])
+		c.at += size
+		switch {
+		case r == '\n':
+			c.pos.line++
+			c.pos.col = 0
+		case r >= 0x10000:
+			c.pos.col += 2
+		default:
+			c.pos.col++
+		}
+	}
+	return c.pos
+}
+
+// mapBuilder collects mappings as output is written.
+type mapBuilder struct {
+	b        strings.Builder
+	genLine  int
+	prevGen  int
+	prevSrc  position
+	segments int
+}
+
+// add says that output at gen came from source at src.
+func (m *mapBuilder) add(gen position, src position) {
+	for m.genLine < gen.line {
+		m.b.WriteByte(';')
+		m.genLine++
+		m.prevGen = 0
+		m.segments = 0
+	}
+	if m.segments > 0 {
+		m.b.WriteByte(',')
+	}
+	m.segments++
+	vlq(&m.b, gen.col-m.prevGen)
+	vlq(&m.b, 0) // The only source
+	vlq(&m.b, src.line-m.prevSrc.line)
+	vlq(&m.b, src.col-m.prevSrc.col)
+	m.prevGen = gen.col
+	m.prevSrc = src
+}
+
+const base64Digits = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+// vlq writes n as a base 64 variable length quantity.
+func vlq(b *strings.Builder, n int) {
+	v := n << 1
+	if n < 0 {
+		v = (-n << 1) | 1
+	}
+	for {
+		digit := v & 31
+		v >>= 5
+		if v > 0 {
+			digit |= 32
+		}
+		b.WriteByte(base64Digits[digit])
+		if v == 0 {
+			return
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package output
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Builds are kept next to the live output directory, in a directory
+// named after it with this suffix.  The live path itself becomes a
+// symlink to one of them.
+const buildsSuffix = ".builds"
+
+// Names inside the builds directory.  Only "build-" entries are complete;
+// "staging-" ones are in progress (or were abandoned), and "previous-"
+// ones are real directories found at the live path and moved aside.
+const (
+	buildPrefix    = "build-"
+	stagingPrefix  = "staging-"
+	previousPrefix = "previous-"
+)
+
+// Build is an output directory being built, to be switched into place
+// with Commit once everything has been written.
+type Build struct {
+	Live   string // The configured output directory
+	Dir    string // Where this build is being written
+	builds string
+	stamp  string
+}
+
+// BuildsDir returns where builds for the live directory are kept.
+func BuildsDir(live string) string {
+	return filepath.Clean(live) + buildsSuffix
+}
+
+// Prepare makes a fresh staging directory for a build of live.
+func Prepare(live string) (*Build, error) {
+	live = filepath.Clean(live)
+	if err := checkLive(live); err != nil {
+		return nil, err
+	}
+	builds := BuildsDir(live)
+	if err := os.MkdirAll(builds, 0755); err != nil {
+		return nil, err
+	}
+	stamp := time.Now().UTC().Format("20060102-150405.000000000")
+	dir, err := ioutil.TempDir(builds, stagingPrefix+stamp+"-")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Build{Live: live, Dir: dir, builds: builds, stamp: strings.TrimPrefix(filepath.Base(dir), stagingPrefix)}, nil
+}
+
+// checkLive refuses live paths we can't safely replace: anything other
+// than a directory or a symlink.
+func checkLive(live string) error {
+	fi, err := os.Lstat(live)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSymlink == 0 && !fi.IsDir() {
+		return fmt.Errorf("%s exists, and is not a directory; refusing to replace it", live)
+	}
+	return nil
+}
+
+// Check makes sure the build produced something worth switching to.
+func (b *Build) Check() error {
+	found := false
+	err := filepath.Walk(b.Dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.Mode().IsRegular() {
+			found = true
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("%s: build produced no files; leaving %s as it was", b.Dir, b.Live)
+	}
+	return nil
+}
+
+// Commit checks the build, then makes it live by pointing the live path
+// at it; the switch is a single rename, so readers see either the old
+// build or the new one.  A real directory found at the live path is
+// moved into the builds directory rather than removed.  All but the
+// newest keep earlier builds are then removed.
+func (b *Build) Commit(keep int) error {
+	if err := b.Check(); err != nil {
+		return err
+	}
+	final := filepath.Join(b.builds, buildPrefix+b.stamp)
+	if err := os.Rename(b.Dir, final); err != nil {
+		return err
+	}
+	b.Dir = final
+
+	if fi, err := os.Lstat(b.Live); err == nil && fi.Mode()&os.ModeSymlink == 0 {
+		aside := filepath.Join(b.builds, previousPrefix+b.stamp)
+		if err := os.Rename(b.Live, aside); err != nil {
+			return err
+		}
+	}
+	if err := point(b.Live, final); err != nil {
+		return err
+	}
+	return Prune(b.Live, keep)
+}
+
+// point atomically makes live a symlink to dir.
+func point(live string, dir string) error {
+	rel, err := filepath.Rel(filepath.Dir(live), dir)
+	if err != nil {
+		return err
+	}
+	tmp := fmt.Sprintf("%s.new-%d", live, os.Getpid())
+	os.Remove(tmp)
+	if err := os.Symlink(rel, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, live); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// List returns the complete builds of live, oldest first, and the one
+// that is live now ("" if none).
+func List(live string) ([]string, string, error) {
+	builds := BuildsDir(filepath.Clean(live))
+	entries, err := ioutil.ReadDir(builds)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, "", err
+	}
+	names := []string{}
+	for _, e := range entries {
+		if e.IsDir() && strings.HasPrefix(e.Name(), buildPrefix) {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+
+	current := ""
+	if target, err := os.Readlink(live); err == nil {
+		current = filepath.Base(target)
+	}
+	return names, current, nil
+}
+
+// Prune removes all but the newest keep builds other than the live one,
+// along with any abandoned staging directories.  Directories moved aside
+// by Commit are left for a person to look at.
+func Prune(live string, keep int) error {
+	names, current, err := List(live)
+	if err != nil {
+		return err
+	}
+	builds := BuildsDir(filepath.Clean(live))
+	old := []string{}
+	for _, name := range names {
+		if name != current {
+			old = append(old, name)
+		}
+	}
+	if len(old) > keep {
+		for _, name := range old[:len(old)-keep] {
+			if err := os.RemoveAll(filepath.Join(builds, name)); err != nil {
+				return err
+			}
+		}
+	}
+
+	entries, err := ioutil.ReadDir(builds)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), stagingPrefix) && time.Since(e.ModTime()) > time.Hour {
+			if err := os.RemoveAll(filepath.Join(builds, e.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Rollback points live back at the newest build older than the current
+// one, and returns that build's directory.
+func Rollback(live string) (string, error) {
+	live = filepath.Clean(live)
+	names, current, err := List(live)
+	if err != nil {
+		return "", err
+	}
+	if current == "" {
+		return "", fmt.Errorf("%s is not a symlink to a build; nothing to roll back", live)
+	}
+	prev := ""
+	for _, name := range names {
+		if name < current {
+			prev = name
+		}
+	}
+	if prev == "" {
+		return "", fmt.Errorf("no build older than %s is kept in %s", current, BuildsDir(live))
+	}
+	dir := filepath.Join(BuildsDir(live), prev)
+	return dir, point(live, dir)
+}
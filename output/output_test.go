@@ -0,0 +1,87 @@
+package output
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func build(t *testing.T, live string, content string, keep int) string {
+	b, err := Prepare(live)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content != "" {
+		ioutil.WriteFile(filepath.Join(b.Dir, "index.html"), []byte(content), 0644)
+	}
+	if err := b.Commit(keep); err != nil {
+		return err.Error()
+	}
+	got, err := ioutil.ReadFile(filepath.Join(live, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(got)
+}
+
+func TestCommitAndRollback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "output_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	live := filepath.Join(dir, "www")
+
+	// An old style output directory is moved aside, not removed.
+	os.MkdirAll(live, 0755)
+	ioutil.WriteFile(filepath.Join(live, "index.html"), []byte("old"), 0644)
+
+	for _, content := range []string{"one", "two", "three", "four"} {
+		if got := build(t, live, content, 2); got != content {
+			t.Fatalf("got %q, want %q", got, content)
+		}
+	}
+	names, current, err := List(live)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 3 || current != names[2] {
+		t.Errorf("kept %v, current %v; want 3 builds, the last one live", names, current)
+	}
+	previous, _ := filepath.Glob(filepath.Join(BuildsDir(live), previousPrefix+"*", "index.html"))
+	if len(previous) != 1 {
+		t.Errorf("old output directory not kept: %v", previous)
+	}
+
+	// An empty build leaves the live one alone.
+	if got := build(t, live, "", 2); !strings.Contains(got, "produced no files") {
+		t.Errorf("empty build: %v", got)
+	}
+
+	for _, want := range []string{"three", "two"} {
+		if _, err := Rollback(live); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := ioutil.ReadFile(filepath.Join(live, "index.html")); string(got) != want {
+			t.Errorf("rollback: got %q, want %q", got, want)
+		}
+	}
+	if _, err := Rollback(live); err == nil || !strings.Contains(err.Error(), "no build older") {
+		t.Errorf("rollback past the oldest: got %v", err)
+	}
+}
+
+func TestPrepareRefusesFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "output_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	live := filepath.Join(dir, "www")
+	ioutil.WriteFile(live, []byte("precious"), 0644)
+	if _, err := Prepare(live); err == nil || !strings.Contains(err.Error(), "not a directory") {
+		t.Errorf("got %v", err)
+	}
+}
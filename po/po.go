@@ -141,29 +141,95 @@ func (f *File) Add(input string, context string, escapequotes bool) {
 
 }
 
-// ApacheAddLanguage  Generates the Apache "AddLanguage" text
-func (f *Files) ApacheAddLanguage() string {
+// DropBelow removes languages less than percent translated, and returns
+// the locales removed.
+func (f *Files) DropBelow(percent int) []string {
+	dropped := []string{}
+	for locale, p := range f.ByLanguage {
+		if p.OutOf > 0 && p.Translated*100 < percent*p.OutOf {
+			delete(f.ByLanguage, locale)
+			dropped = append(dropped, locale)
+		}
+	}
+	sort.Strings(dropped)
+	return dropped
+}
+
+// LanguageTag pairs an Accept-Language tag with the locale that
+// serves it.
+type LanguageTag struct {
+	Tag    string // "fr" or "fr-FR"
+	Locale string // "fr_FR"
+}
+
+// LanguageTags lists the language tags each locale answers to: its
+// language alone, and the full locale with a dash.  en_US comes first,
+// as the default.
+func (f *Files) LanguageTags() []LanguageTag {
 	list := append([]string{"en_US"}, f.Languages()...)
-	text := ""
-	seen := make(map[string]bool)
+	tags := []LanguageTag{}
+	seen := make(map[LanguageTag]bool)
 
-	add := func(s string) {
-		if seen[s] == false {
-			text = text + s + "\n"
-			seen[s] = true
+	add := func(t LanguageTag) {
+		if seen[t] == false {
+			tags = append(tags, t)
+			seen[t] = true
 		}
 	}
 
 	for _, locale := range list {
 		parts := strings.Split(locale, "_")
 		if len(parts) > 0 {
-			add(fmt.Sprintf("AddLanguage %s .%s", parts[0], locale))
+			add(LanguageTag{parts[0], locale})
 		}
-		dashed := strings.Replace(locale, "_", "-", -1)
-		add(fmt.Sprintf("AddLanguage %s .%s", dashed, locale))
+		add(LanguageTag{strings.Replace(locale, "_", "-", -1), locale})
+	}
+	return tags
+}
 
+// ApacheAddLanguage  Generates the Apache "AddLanguage" text
+func (f *Files) ApacheAddLanguage() string {
+	text := ""
+	for _, t := range f.LanguageTags() {
+		text = text + fmt.Sprintf("AddLanguage %s .%s", t.Tag, t.Locale) + "\n"
 	}
+	return text
+}
 
+// languageMap is the body of a map from Accept-Language to locale, for
+// servers without Apache's negotiation: the first language the client
+// names picks the locale, and q values are ignored.  Each line is
+// format applied to a regular expression and a locale; where two
+// locales share a tag, the first wins.
+func (f *Files) languageMap(format string) string {
+	text := ""
+	seen := make(map[string]bool)
+	for _, t := range f.LanguageTags() {
+		tag := strings.ToLower(t.Tag)
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		re := "^" + regexp.QuoteMeta(tag) + "([,;\\s]|$)"
+		text = text + fmt.Sprintf(format, re, t.Locale) + "\n"
+	}
 	return text
+}
+
+// NginxLanguageMap generates an nginx "map $http_accept_language" block
+// setting $fs_locale.
+func (f *Files) NginxLanguageMap() string {
+	return "map $http_accept_language $fs_locale {\n" +
+		"    default en_US;\n" +
+		f.languageMap("    \"~*%s\" %s;") +
+		"}\n"
+}
 
+// CaddyLanguageMap generates a Caddyfile "map" directive setting
+// {fs_locale}, indented for a site block.
+func (f *Files) CaddyLanguageMap() string {
+	return "\tmap {header.Accept-Language} {fs_locale} {\n" +
+		f.languageMap("\t\t\"~(?i)%s\" %s") +
+		"\t\tdefault en_US\n" +
+		"\t}\n"
 }
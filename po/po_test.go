@@ -1,6 +1,7 @@
 package po
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -45,3 +46,43 @@ func TestLoadAll(t *testing.T) {
 	}
 	//t.Logf("%#v", multi.ByLanguage["pt_BR"])
 }
+
+func TestDropBelow(t *testing.T) {
+	f := &Files{ByLanguage: MapStringFile{
+		"fr_FR": &File{Translated: 90, OutOf: 100},
+		"de_DE": &File{Translated: 49, OutOf: 100},
+		"xx_XX": &File{},
+	}}
+	dropped := f.DropBelow(50)
+	if len(dropped) != 1 || dropped[0] != "de_DE" {
+		t.Errorf("dropped %v", dropped)
+	}
+	if _, ok := f.ByLanguage["fr_FR"]; !ok || len(f.ByLanguage) != 2 {
+		t.Errorf("left %v", f.Languages())
+	}
+}
+
+func TestLanguageMaps(t *testing.T) {
+	f := &Files{ByLanguage: MapStringFile{
+		"fr_FR": &File{Language: "fr_FR"},
+		"fr_CA": &File{Language: "fr_CA"},
+	}}
+	want := "AddLanguage en .en_US\nAddLanguage en-US .en_US\n" +
+		"AddLanguage fr .fr_CA\nAddLanguage fr-CA .fr_CA\n" +
+		"AddLanguage fr .fr_FR\nAddLanguage fr-FR .fr_FR\n"
+	if got := f.ApacheAddLanguage(); got != want {
+		t.Errorf("ApacheAddLanguage:\n%s\nwant\n%s", got, want)
+	}
+	nginx := f.NginxLanguageMap()
+	for _, line := range []string{`"~*^fr([,;\s]|$)" fr_CA;`, `"~*^fr-fr([,;\s]|$)" fr_FR;`, "default en_US;"} {
+		if !strings.Contains(nginx, line) {
+			t.Errorf("NginxLanguageMap lacks %q:\n%s", line, nginx)
+		}
+	}
+	if strings.Count(nginx, `"~*^fr(`) != 1 {
+		t.Errorf("NginxLanguageMap maps fr twice:\n%s", nginx)
+	}
+	if caddy := f.CaddyLanguageMap(); !strings.Contains(caddy, `"~(?i)^en-us([,;\s]|$)" en_US`) {
+		t.Errorf("CaddyLanguageMap:\n%s", caddy)
+	}
+}
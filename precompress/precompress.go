@@ -0,0 +1,152 @@
+// Package precompress writes compressed copies of outputs, so that web
+// servers can send them as they are.  Encodings are pluggable; gzip,
+// brotli and zstd are built in.
+package precompress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Encoder is one way of compressing outputs.
+type Encoder struct {
+	Name        string                         // Content-Encoding, and how pipeline rules ask for it
+	Extension   string                         // Added to output names, such as ".gz"
+	NginxStatic string                         // nginx directive serving such copies, such as gzip_static
+	Encode      func(b []byte) ([]byte, error) `json:"-"`
+}
+
+// Short is Extension without its dot, for use in variable names.
+func (e *Encoder) Short() string {
+	return strings.TrimPrefix(e.Extension, ".")
+}
+
+// Worthwhile reports whether compressing size bytes down to compressed
+// saves at least minSavings (a fraction, such as 0.05) of it.
+func Worthwhile(size int, compressed int, minSavings float64) bool {
+	if size == 0 {
+		return false
+	}
+	return float64(size-compressed) >= minSavings*float64(size)
+}
+
+var registry struct {
+	lock  sync.RWMutex
+	order []*Encoder
+}
+
+// Register adds an encoder.  Encoders registered first are preferred,
+// where a server has to pick one.
+func Register(e *Encoder) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+	for i, old := range registry.order {
+		if old.Name == e.Name {
+			registry.order[i] = e
+			return
+		}
+	}
+	registry.order = append(registry.order, e)
+}
+
+// Get returns the encoder called name.
+func Get(name string) (*Encoder, bool) {
+	registry.lock.RLock()
+	defer registry.lock.RUnlock()
+	for _, e := range registry.order {
+		if e.Name == name {
+			return e, true
+		}
+	}
+	return nil, false
+}
+
+// Names lists the registered encoders, sorted.
+func Names() []string {
+	registry.lock.RLock()
+	defer registry.lock.RUnlock()
+	names := []string{}
+	for _, e := range registry.order {
+		names = append(names, e.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Select returns the named encoders, in order of preference.  Unknown
+// names are left out; config validation reports them.
+func Select(names []string) []*Encoder {
+	registry.lock.RLock()
+	defer registry.lock.RUnlock()
+	want := make(map[string]bool)
+	for _, n := range names {
+		want[n] = true
+	}
+	list := []*Encoder{}
+	for _, e := range registry.order {
+		if want[e.Name] {
+			list = append(list, e)
+		}
+	}
+	return list
+}
+
+// All returns every registered encoder, in order of preference.
+func All() []*Encoder {
+	registry.lock.RLock()
+	defer registry.lock.RUnlock()
+	return append([]*Encoder{}, registry.order...)
+}
+
+func init() {
+	Register(&Encoder{Name: "br", Extension: ".br", NginxStatic: "brotli_static", Encode: Brotli})
+	Register(&Encoder{Name: "zstd", Extension: ".zst", NginxStatic: "zstd_static", Encode: Zstd})
+	Register(&Encoder{Name: "gzip", Extension: ".gz", NginxStatic: "gzip_static", Encode: Gzip})
+}
+
+// Gzip compresses b at the best level.  The output depends only on b:
+// the header holds no file name or modification time.
+func Gzip(b []byte) ([]byte, error) {
+	out := &bytes.Buffer{}
+	w, err := gzip.NewWriterLevel(out, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	w.Header = gzip.Header{OS: 255} // No name, no mtime; "unknown" OS
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// Brotli compresses b at the best level.
+func Brotli(b []byte) ([]byte, error) {
+	out := &bytes.Buffer{}
+	w := brotli.NewWriterLevel(out, brotli.BestCompression)
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// Zstd compresses b at the best level.
+func Zstd(b []byte) ([]byte, error) {
+	w, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedBestCompression), zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	defer w.Close()
+	return w.EncodeAll(b, nil), nil
+}
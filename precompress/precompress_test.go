@@ -0,0 +1,71 @@
+package precompress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+var text = []byte(strings.Repeat("Test your IPv6 connectivity. ", 200))
+
+func TestRoundTrip(t *testing.T) {
+	for _, e := range All() {
+		b, err := e.Encode(text)
+		if err != nil {
+			t.Fatalf("%s: %v", e.Name, err)
+		}
+		var out []byte
+		switch e.Name {
+		case "gzip":
+			r, err := gzip.NewReader(bytes.NewReader(b))
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, err = ioutil.ReadAll(r)
+		case "br":
+			out, err = ioutil.ReadAll(brotli.NewReader(bytes.NewReader(b)))
+		case "zstd":
+			r, _ := zstd.NewReader(nil)
+			out, err = r.DecodeAll(b, nil)
+		}
+		if err != nil || !bytes.Equal(out, text) {
+			t.Errorf("%s: round trip failed: %v", e.Name, err)
+		}
+		if len(b) >= len(text)/10 {
+			t.Errorf("%s: %v bytes from %v", e.Name, len(b), len(text))
+		}
+	}
+}
+
+func TestGzipDeterministic(t *testing.T) {
+	a, _ := Gzip(text)
+	b, _ := Gzip(text)
+	if !bytes.Equal(a, b) {
+		t.Errorf("two compressions differ")
+	}
+	r, err := gzip.NewReader(bytes.NewReader(a))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Name != "" || !r.ModTime.IsZero() {
+		t.Errorf("header has name %q, mtime %v", r.Name, r.ModTime)
+	}
+}
+
+func TestSelect(t *testing.T) {
+	var names []string
+	for _, e := range Select([]string{"gzip", "nope", "br"}) {
+		names = append(names, e.Name)
+	}
+	if strings.Join(names, ",") != "br,gzip" {
+		t.Errorf("Select: %v", names)
+	}
+	if !Worthwhile(1000, 900, 0.1) || Worthwhile(1000, 901, 0.1) || Worthwhile(0, 0, 0) {
+		t.Errorf("Worthwhile is wrong")
+	}
+}
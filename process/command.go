@@ -0,0 +1,123 @@
+package process
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// timeout is how long the step's command may run.
+func (s *Step) timeout() (time.Duration, error) {
+	if s.Timeout == "" {
+		return DefaultTimeout, nil
+	}
+	d, err := time.ParseDuration(s.Timeout)
+	if err != nil {
+		return 0, fmt.Errorf("bad Timeout: %v", err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("Timeout %s must be positive", s.Timeout)
+	}
+	return d, nil
+}
+
+// exitOK reports whether the step accepts exit status code.
+func (s *Step) exitOK(code int) bool {
+	if len(s.ExitCodes) == 0 {
+		return code == 0
+	}
+	for _, ok := range s.ExitCodes {
+		if ok == code {
+			return true
+		}
+	}
+	return false
+}
+
+// macros are in.Macros for step.  They name files relative to the
+// output directory; with a Dir of its own, a step gets full paths.
+func (s *Step) macros(in *Input) map[string]string {
+	if s.Dir == "" {
+		return in.Macros
+	}
+	m := make(map[string]string)
+	for k, v := range in.Macros {
+		abs, err := filepath.Abs(filepath.Join(in.Dir, v))
+		if err != nil {
+			abs = filepath.Join(in.Dir, v)
+		}
+		m[k] = abs
+	}
+	return m
+}
+
+// command runs argv for step, with stdin as its input, and returns what
+// it printed.  The step's timeout, environment, working directory and
+// exit codes apply.  The diagnostic is filled in either way.
+func command(step *Step, in *Input, argv []string, stdin []byte) ([]byte, *Diagnostic, error) {
+	d := &Diagnostic{Step: step.String()}
+	timeout, err := step.timeout()
+	if err != nil {
+		d.Error = err.Error()
+		return nil, d, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	c := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	c.Dir = in.Dir
+	if step.Dir != "" {
+		c.Dir = step.Dir
+		if !filepath.IsAbs(step.Dir) {
+			c.Dir = filepath.Join(in.Dir, step.Dir)
+		}
+	}
+	if len(step.Env) > 0 {
+		names := []string{}
+		for k := range step.Env {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		c.Env = os.Environ()
+		for _, k := range names {
+			c.Env = append(c.Env, k+"="+expand(step.Env[k], step.macros(in), func(v string) string { return v }))
+		}
+	}
+	c.Stdin = bytes.NewReader(stdin)
+	c.Stdout = stdout
+	c.Stderr = stderr
+	killGroup(c)
+	c.WaitDelay = time.Second // Don't wait on children holding the pipes
+
+	t0 := time.Now()
+	err = c.Run()
+	d.Seconds = time.Since(t0).Seconds()
+	d.Stderr = stderr.String()
+	if c.ProcessState != nil {
+		d.ExitCode = c.ProcessState.ExitCode()
+	}
+
+	var exit *exec.ExitError
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		err = fmt.Errorf("timed out after %v", timeout)
+	case errors.As(err, &exit) && step.exitOK(d.ExitCode):
+		err = nil
+	}
+	if err != nil {
+		d.Error = err.Error()
+		if msg := strings.TrimSpace(d.Stderr); msg != "" {
+			err = fmt.Errorf("%v: %s", err, msg)
+		}
+	}
+	return stdout.Bytes(), d, err
+}
@@ -0,0 +1,28 @@
+package process
+
+import "fmt"
+
+// execProcessor runs a command directly, not through a shell, with the
+// output on its standard input; what it prints becomes the new output.
+type execProcessor struct {
+	step *Step
+}
+
+func init() {
+	Register("exec", func(step *Step) (Processor, error) {
+		if len(step.Args) == 0 {
+			return nil, fmt.Errorf("exec needs a command in Args")
+		}
+		return &execProcessor{step: step}, nil
+	})
+}
+
+func (p *execProcessor) Process(in *Input) (*Output, error) {
+	argv := make([]string, len(p.step.Args))
+	for i, arg := range p.step.Args {
+		argv[i] = expand(arg, p.step.macros(in), func(v string) string { return v })
+	}
+	stdout, d, err := command(p.step, in, argv, in.Content)
+	out := &Output{Content: stdout, Diagnostics: []Diagnostic{*d}}
+	return out, err
+}
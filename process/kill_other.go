@@ -0,0 +1,8 @@
+//go:build !unix
+
+package process
+
+import "os/exec"
+
+// killGroup does nothing here; a timeout kills just the command.
+func killGroup(c *exec.Cmd) {}
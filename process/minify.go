@@ -0,0 +1,52 @@
+package process
+
+import (
+	"fmt"
+
+	"github.com/falling-sky/builder/minify"
+)
+
+// minifyProcessor runs a built-in minifier.  Args are its type, then
+// any of "safe" and "sourcemap"; see minify.Step.
+type minifyProcessor struct {
+	step minify.Step
+}
+
+func init() {
+	Register("minify", func(step *Step) (Processor, error) {
+		if len(step.Args) == 0 {
+			return nil, fmt.Errorf("minify needs a type in Args (want one of %v)", minify.Types())
+		}
+		p := &minifyProcessor{step: minify.Step{Type: step.Args[0]}}
+		for _, arg := range step.Args[1:] {
+			switch arg {
+			case "safe":
+				p.step.Safe = true
+			case "sourcemap":
+				p.step.SourceMap = true
+			default:
+				return nil, fmt.Errorf("unknown minify option %q (want safe or sourcemap)", arg)
+			}
+		}
+		if err := p.step.Check(); err != nil {
+			return nil, err
+		}
+		return p, nil
+	})
+}
+
+func (p *minifyProcessor) Process(in *Input) (*Output, error) {
+	r, err := minify.Run(&p.step, in.Name, string(in.Content))
+	if err != nil {
+		return nil, err
+	}
+	out := &Output{Content: []byte(r.Text)}
+	if r.Map != nil {
+		b, err := r.Map.JSON()
+		if err != nil {
+			return nil, err
+		}
+		out.Files = map[string][]byte{in.Name + ".map": b}
+	}
+	return out, nil
+}
@@ -0,0 +1,204 @@
+// Package process runs the post-processing steps configured for each
+// kind of output.  A step names a registered Processor, which gets the
+// output's bytes and returns new ones, plus any extra files it made.
+// Built in are exec (a command, given its arguments directly), minify
+// (see package minify), and shell, for the older one-line commands.
+package process
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout is how long a command may run, unless its step says.
+const DefaultTimeout = 5 * time.Minute
+
+// Step is one processor in a Processors list.  ExitCodes, Timeout, Env
+// and Dir are for the commands run by exec and shell.
+type Step struct {
+	Processor string            // Registered name: exec, minify or shell
+	Args      []string          // For exec, the command and its arguments; macros such as [NAME] are replaced in each
+	ExitCodes []int             // Exit statuses that count as success; just 0 if empty
+	Timeout   string            // How long the command may run, such as 30s; DefaultTimeout if empty
+	Env       map[string]string // Added to the builder's own environment; macros are replaced
+	Dir       string            // Working directory, relative to the output directory; macros become full paths
+}
+
+// UnmarshalJSON takes a plain string as a shell command, as configs
+// written before steps had names still use.
+func (s *Step) UnmarshalJSON(b []byte) error {
+	var cmd string
+	if err := json.Unmarshal(b, &cmd); err == nil {
+		*s = Step{Processor: "shell", Args: []string{cmd}}
+		return nil
+	}
+	type plain Step // Without this method
+	var p plain
+	d := json.NewDecoder(strings.NewReader(string(b)))
+	d.DisallowUnknownFields()
+	if err := d.Decode(&p); err != nil {
+		return err
+	}
+	*s = Step(p)
+	return nil
+}
+
+// String is the step as a command line, for messages.
+func (s *Step) String() string {
+	return s.Processor + " " + strings.Join(s.Args, " ")
+}
+
+// Input is what a processor works on.
+type Input struct {
+	Name    string            // Output file, relative to Dir, such as index.js.en_US
+	Dir     string            // The output directory
+	Content []byte            // The output so far
+	Macros  map[string]string // Values for [NAME] and the rest; see Macros
+}
+
+// Output is what a processor made of its input.
+type Output struct {
+	Content     []byte
+	Files       map[string][]byte // Further files to write, relative to Dir, such as index.js.en_US.map
+	Diagnostics []Diagnostic      // What commands said, for the build report
+}
+
+// Diagnostic is what one command said, and how it ended.
+type Diagnostic struct {
+	Step     string  // The step, as a command line
+	ExitCode int     // -1 if it didn't exit by itself
+	Seconds  float64 // How long it ran
+	Stdout   string  `json:",omitempty"` // Unless it was the output
+	Stderr   string  `json:",omitempty"`
+	Error    string  `json:",omitempty"` // Why the step failed
+}
+
+// Quiet is true when there is nothing in d worth reporting.
+func (d *Diagnostic) Quiet() bool {
+	return d.ExitCode == 0 && d.Stdout == "" && d.Stderr == "" && d.Error == ""
+}
+
+// Processor is one kind of post-processing step.  A processor that
+// fails may still return an Output, for its Diagnostics.
+type Processor interface {
+	Process(in *Input) (*Output, error)
+}
+
+// Factory makes a processor for a configured step, or says what is
+// wrong with it.
+type Factory func(step *Step) (Processor, error)
+
+// Macros are the names processor arguments may use in square brackets.
+var Macros = []string{"NAME", "NAMEGZ", "INPUT", "OUTPUT"}
+
+// reMACRO matches a [MACRO] in a processor argument.
+var reMACRO = regexp.MustCompile(`\[([A-Z][A-Z0-9_]*)\]`)
+
+var registry = struct {
+	lock   sync.RWMutex
+	byname map[string]Factory
+}{byname: make(map[string]Factory)}
+
+// Register adds a processor, replacing any of the same name.
+func Register(name string, f Factory) {
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+	registry.byname[name] = f
+}
+
+// Names lists the registered processors, sorted.
+func Names() []string {
+	registry.lock.RLock()
+	defer registry.lock.RUnlock()
+	names := []string{}
+	for name := range registry.byname {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New makes the processor for step.
+func New(step *Step) (Processor, error) {
+	registry.lock.RLock()
+	f, ok := registry.byname[step.Processor]
+	registry.lock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown processor %q (want one of %s)", step.Processor, strings.Join(Names(), ", "))
+	}
+	return f(step)
+}
+
+// Check makes sure a step can be made, and only uses known macros.
+func (s *Step) Check() error {
+	if _, err := New(s); err != nil {
+		return err
+	}
+	if _, err := s.timeout(); err != nil {
+		return err
+	}
+	for _, code := range s.ExitCodes {
+		if code < 0 || code > 255 {
+			return fmt.Errorf("exit code %v is out of range (0 to 255)", code)
+		}
+	}
+	known := make(map[string]bool)
+	for _, m := range Macros {
+		known[m] = true
+	}
+	values := append([]string{}, s.Args...)
+	for _, v := range s.Env {
+		values = append(values, v)
+	}
+	for _, arg := range values {
+		for _, m := range reMACRO.FindAllStringSubmatch(arg, -1) {
+			if !known[m[1]] {
+				return fmt.Errorf("unknown macro %s (want one of %s)", m[0], strings.Join(Macros, ", "))
+			}
+		}
+	}
+	return nil
+}
+
+// Run passes in through each step in turn.  Files from later steps
+// replace those of the same name from earlier ones.  The Output is
+// returned even on error, with the Diagnostics gathered so far.
+func Run(steps []Step, in *Input) (*Output, error) {
+	result := &Output{Content: in.Content, Files: make(map[string][]byte)}
+	for i := range steps {
+		p, err := New(&steps[i])
+		if err != nil {
+			return result, err
+		}
+		next := *in
+		next.Content = result.Content
+		out, err := p.Process(&next)
+		if out != nil {
+			result.Diagnostics = append(result.Diagnostics, out.Diagnostics...)
+		}
+		if err != nil {
+			return result, fmt.Errorf("%s: %v", steps[i].String(), err)
+		}
+		result.Content = out.Content
+		for name, b := range out.Files {
+			result.Files[name] = b
+		}
+	}
+	return result, nil
+}
+
+// expand replaces the macros in s.
+func expand(s string, macros map[string]string, quote func(string) string) string {
+	return reMACRO.ReplaceAllStringFunc(s, func(m string) string {
+		v, ok := macros[m[1:len(m)-1]]
+		if !ok {
+			return m
+		}
+		return quote(v)
+	})
+}
@@ -0,0 +1,183 @@
+package process
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUnmarshal(t *testing.T) {
+	var steps []Step
+	text := `["gzip < [NAME] > [NAMEGZ]", {"Processor": "exec", "Args": ["tr", "a-z", "A-Z"]}]`
+	if err := json.Unmarshal([]byte(text), &steps); err != nil {
+		t.Fatal(err)
+	}
+	want := []Step{
+		{Processor: "shell", Args: []string{"gzip < [NAME] > [NAMEGZ]"}},
+		{Processor: "exec", Args: []string{"tr", "a-z", "A-Z"}},
+	}
+	if !reflect.DeepEqual(steps, want) {
+		t.Errorf("got %+v, want %+v", steps, want)
+	}
+	if err := json.Unmarshal([]byte(`[{"Processor": "exec", "Argv": []}]`), &steps); err == nil {
+		t.Error("unknown field was accepted")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	for _, tt := range []struct {
+		step Step
+		want string
+	}{
+		{Step{Processor: "exec", Args: []string{"cat", "[NAME]"}}, ""},
+		{Step{Processor: "exec"}, "exec needs a command"},
+		{Step{Processor: "shell", Args: []string{"cat [NAMEZ]"}}, "unknown macro [NAMEZ]"},
+		{Step{Processor: "minify", Args: []string{"css", "sourcemap"}}, "SourceMap is only for js"},
+		{Step{Processor: "tidy"}, `unknown processor "tidy"`},
+	} {
+		err := tt.step.Check()
+		if tt.want == "" && err != nil || tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)) {
+			t.Errorf("%v: got %v, want %q", tt.step.String(), err, tt.want)
+		}
+	}
+}
+
+// TestNoInjection runs both kinds of command with a file name that
+// would do something else, if a shell saw it unquoted.
+func TestNoInjection(t *testing.T) {
+	dir, err := ioutil.TempDir("", "process")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := "a b; touch pwned.html"
+	in := &Input{
+		Name:    name,
+		Dir:     dir,
+		Content: []byte("hello\n"),
+		Macros:  map[string]string{"NAME": name, "INPUT": name + ".orig", "OUTPUT": name},
+	}
+
+	steps := []Step{
+		{Processor: "shell", Args: []string{"tr a-z A-Z < [INPUT] > [OUTPUT]"}},
+		{Processor: "exec", Args: []string{"sed", "s/$/ [NAME]/"}},
+		{Processor: "minify", Args: []string{"js", "sourcemap"}},
+	}
+	out, err := Run(steps, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "HELLO a b;touch pwned.html\n//# sourceMappingURL=" + name + ".map\n"; string(out.Content) != want {
+		t.Errorf("got %q, want %q", out.Content, want)
+	}
+	if _, ok := out.Files[name+".map"]; !ok {
+		t.Errorf("no source map in %v", out.Files)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "pwned.html")); err == nil {
+		t.Error("the file name ran as a command")
+	}
+	if _, err := os.Stat(filepath.Join(dir, name+".orig")); err == nil {
+		t.Error("[INPUT] was left behind")
+	}
+}
+
+func TestExecFailure(t *testing.T) {
+	_, err := Run([]Step{{Processor: "exec", Args: []string{"sh", "-c", "echo broken >&2; exit 3"}}}, &Input{Name: "x"})
+	if err == nil || !strings.Contains(err.Error(), "exit status 3: broken") {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestExitCodes(t *testing.T) {
+	step := Step{Processor: "exec", Args: []string{"sh", "-c", "cat; echo warned >&2; exit 1"}, ExitCodes: []int{0, 1}}
+	out, err := Run([]Step{step}, &Input{Name: "x", Content: []byte("same\n")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out.Content) != "same\n" {
+		t.Errorf("got %q", out.Content)
+	}
+	if len(out.Diagnostics) != 1 || out.Diagnostics[0].ExitCode != 1 || out.Diagnostics[0].Stderr != "warned\n" {
+		t.Errorf("got %+v", out.Diagnostics)
+	}
+
+	dir, err := ioutil.TempDir("", "process")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	in := &Input{Name: "x", Dir: dir, Content: []byte("same\n"), Macros: map[string]string{"NAME": "x", "INPUT": "x.orig", "OUTPUT": "x"}}
+	_, err = Run([]Step{{Processor: "shell", Args: []string{"cp [INPUT] [OUTPUT]; exit 1"}}}, in)
+	if err == nil || !strings.Contains(err.Error(), `"ExitCodes": [0, 1]`) {
+		t.Errorf("shell step exiting 1: got %v", err)
+	}
+	out, err = Run([]Step{{Processor: "shell", Args: []string{"cp [INPUT] [OUTPUT]; exit 1"}, ExitCodes: []int{0, 1}}}, in)
+	if err != nil || string(out.Content) != "same\n" {
+		t.Errorf("shell step with ExitCodes: got %q, %v", out.Content, err)
+	}
+
+	if err := (&Step{Processor: "exec", Args: []string{"true"}, ExitCodes: []int{256}}).Check(); err == nil {
+		t.Error("exit code 256 passed Check")
+	}
+}
+
+// TestTimeout makes sure a hung command, or a shell waiting on one,
+// fails its step rather than the build waiting forever.
+func TestTimeout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "process")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	in := &Input{Name: "x", Dir: dir, Macros: map[string]string{"NAME": "x", "INPUT": "x.orig", "OUTPUT": "x"}}
+
+	for _, step := range []Step{
+		{Processor: "exec", Args: []string{"sleep", "10"}, Timeout: "200ms"},
+		{Processor: "shell", Args: []string{"sleep 10; cp [INPUT] [OUTPUT]"}, Timeout: "200ms"},
+	} {
+		t0 := time.Now()
+		out, err := Run([]Step{step}, in)
+		if err == nil || !strings.Contains(err.Error(), "timed out after 200ms") {
+			t.Errorf("%v: got %v", step.String(), err)
+		}
+		if took := time.Since(t0); took > 5*time.Second {
+			t.Errorf("%v: took %v", step.String(), took)
+		}
+		if len(out.Diagnostics) != 1 || out.Diagnostics[0].Error == "" {
+			t.Errorf("%v: got %+v", step.String(), out.Diagnostics)
+		}
+	}
+	if err := (&Step{Processor: "exec", Args: []string{"true"}, Timeout: "soon"}).Check(); err == nil {
+		t.Error("bad Timeout passed Check")
+	}
+}
+
+func TestEnvAndDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "process")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	in := &Input{Name: "x", Dir: dir, Macros: map[string]string{"NAME": "x"}}
+	step := Step{
+		Processor: "exec",
+		Args:      []string{"sh", "-c", `echo "$GREETING $(basename "$PWD")"`},
+		Env:       map[string]string{"GREETING": "hello [NAME]"},
+		Dir:       "sub",
+	}
+	out, err := Run([]Step{step}, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "hello " + filepath.Join(dir, "x") + " sub\n"; string(out.Content) != want {
+		t.Errorf("got %q, want %q", out.Content, want)
+	}
+}
@@ -0,0 +1,55 @@
+package process
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// shellProcessor runs a one-line /bin/sh command, as processors were
+// configured before they had names.  The output is written to [INPUT]
+// first, and the command is expected to leave its result in [NAME].
+// Macro values are quoted, so that odd file names stay single words.
+type shellProcessor struct {
+	step *Step
+}
+
+func init() {
+	Register("shell", func(step *Step) (Processor, error) {
+		if len(step.Args) != 1 {
+			return nil, fmt.Errorf("shell takes one command line in Args, not %v", len(step.Args))
+		}
+		return &shellProcessor{step: step}, nil
+	})
+}
+
+func (p *shellProcessor) Process(in *Input) (*Output, error) {
+	input := filepath.Join(in.Dir, in.Macros["INPUT"])
+	os.MkdirAll(filepath.Dir(input), 0755)
+	if err := ioutil.WriteFile(input, in.Content, 0644); err != nil {
+		return nil, err
+	}
+	defer os.Remove(input)
+
+	argv := []string{"/bin/sh", "-c", expand(p.step.Args[0], p.step.macros(in), shellQuote)}
+	stdout, d, err := command(p.step, in, argv, nil)
+	d.Stdout = string(stdout)
+	out := &Output{Diagnostics: []Diagnostic{*d}}
+	if err != nil {
+		if d.ExitCode > 0 && len(p.step.ExitCodes) == 0 {
+			// tidy, for one, exits 1 when it only has warnings.
+			err = fmt.Errorf(`%v; if exit status %d is expected, write the step as {"Processor": "shell", "Args": [%q], "ExitCodes": [0, %d]}`,
+				err, d.ExitCode, p.step.Args[0], d.ExitCode)
+		}
+		return out, err
+	}
+	out.Content, err = ioutil.ReadFile(filepath.Join(in.Dir, in.Name))
+	return out, err
+}
+
+// shellQuote makes s a single word for /bin/sh.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
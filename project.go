@@ -0,0 +1,279 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/falling-sky/builder/assets"
+	"github.com/falling-sky/builder/config"
+	"github.com/falling-sky/builder/data"
+	"github.com/falling-sky/builder/fileutil"
+	"github.com/falling-sky/builder/gitinfo"
+	"github.com/falling-sky/builder/job"
+	"github.com/falling-sky/builder/manifest"
+	"github.com/falling-sky/builder/po"
+	"github.com/falling-sky/builder/precompress"
+	"github.com/falling-sky/builder/signature"
+	"github.com/falling-sky/builder/sites"
+)
+
+// project is everything loaded before templates can be queued.  A normal
+// build uses it once; "builder watch" keeps it, reloading parts of it as
+// their files change.
+type project struct {
+	conf         *config.Record
+	cache        *job.BuildCache
+	files        *fileutil.FileCache  // Template files, as read
+	parsed       *job.ParsedCacheType // Templates, as expanded
+	jobTracker   *job.QueueTracker
+	languages    *po.Files
+	gitInfo      *gitinfo.GitInfo
+	dataByLocale map[string]map[string]interface{}
+	sites        *sites.List
+	assets       *assets.Manifest
+	report       *job.Report // What processors said in the last runJobs
+	manifest     *manifest.Manifest
+}
+
+// loadProject loads translations, data files and the site list for conf.
+func loadProject(conf *config.Record) *project {
+	p := &project{conf: conf, assets: assets.NewManifest(), manifest: manifest.New()}
+	p.files = fileutil.NewFileCache()
+	p.parsed = job.NewParsedCache(p.files)
+
+	// Outputs of earlier builds, for jobs whose inputs haven't changed.
+	cache, err := job.OpenCache(conf.Directories.CacheDir, *explain)
+	if err != nil {
+		log.Fatal(err)
+	}
+	p.cache = cache
+
+	// Start the job queue for templates
+	p.jobTracker = job.StartQueue(conf.Options.MaxThreads)
+
+	// Grab this just once.
+	p.gitInfo = gitinfo.GetGitInfo()
+
+	// What built this, for the manifest.
+	p.manifest.Build.GitInfo = p.gitInfo
+	p.manifest.Build.BuilderVersion = version
+	if exe, err := os.Executable(); err == nil {
+		if b, err := ioutil.ReadFile(exe); err == nil {
+			p.manifest.Build.BuilderSHA256 = manifest.SHA256(b)
+		}
+	}
+
+	p.loadLanguages()
+	p.loadData()
+	return p
+}
+
+// loadLanguages loads all langauges, and calculates all percentages of completion.
+func (p *project) loadLanguages() {
+	conf := p.conf
+	languages, err := po.LoadAll(conf.Directories.PoDir+"/falling-sky.pot", conf.Directories.PoDir+"/dl")
+	if err != nil {
+		log.Fatal(err)
+	}
+	languages.Pot.Language = "en_US"
+	for _, locale := range languages.DropBelow(conf.Options.MinTranslated) {
+		log.Printf("skipping %s: under %v%% translated\n", locale, conf.Options.MinTranslated)
+	}
+	p.languages = languages
+}
+
+// loadData loads the data files for templates, the locale specific views
+// of them, and the site list.
+func (p *project) loadData() {
+	conf := p.conf
+	dataSet, err := data.LoadDir(conf.Directories.DataDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	siteList, err := sites.Load(conf.Directories.SitesFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	dataByLocale := make(map[string]map[string]interface{})
+	for _, locale := range append([]string{"en_US"}, p.languages.Languages()...) {
+		dataByLocale[locale] = dataSet.ForLocale(locale)
+	}
+	p.dataByLocale = dataByLocale
+	p.sites = siteList
+}
+
+// runJobs queues a job for each template and locale, and waits for them
+// all.  If want is given, only templates it approves (by pipeline directory
+// and file name) are queued.  It returns how many jobs ran.
+//
+// Fingerprinted assets are built first, since pages ask for their names.
+// If any of those names change, every page is rebuilt.
+func (p *project) runJobs(want func(dir string, file string) bool) int {
+	typeMaps := make(map[string]bool)
+	p.report = job.NewReport()
+
+	before := string(p.assets.JSON())
+	count := p.queueJobs(true, want, typeMaps)
+	p.jobTracker.Wait()
+	if len(p.assets.Files) > 0 {
+		if err := p.assets.Save(p.conf.Directories.OutputDir); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if string(p.assets.JSON()) != before {
+		want = nil
+	}
+
+	count += p.queueJobs(false, want, typeMaps)
+	p.jobTracker.Wait()
+
+	// Type maps list whatever variants are there now.
+	for name := range typeMaps {
+		p.writeTypeMap(name)
+	}
+
+	// What processors had to say, if anything.  It stays out of the
+	// output directory, which is published.
+	fn := filepath.Join(p.conf.Directories.CacheDir, "report.json")
+	if err := p.report.Save(fn); err != nil {
+		log.Fatal(err)
+	}
+	if n := len(p.report.Steps); n > 0 {
+		log.Printf("%v processor steps had something to say; see %s\n", n, fn)
+	}
+	return count
+}
+
+// queueJobs queues the jobs for rules that are, or aren't, fingerprinted,
+// noting the multi-locale outputs in typeMaps.  It returns how many it
+// queued.
+func (p *project) queueJobs(fingerprinted bool, want func(dir string, file string) bool, typeMaps map[string]bool) int {
+	conf := p.conf
+	languages := p.languages
+	count := 0
+
+	for _, dir := range conf.PipelineDirs() {
+		inputDir := conf.Directories.TemplateDir + "/" + dir
+		files, err := fileutil.FilesInDirNotRecursive(inputDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		//	log.Printf("files: %#v\n", files)
+
+		rootDir := conf.Directories.TemplateDir + "/" + dir
+		addLanguages := languages.ApacheAddLanguage()
+		signatureDirs := conf.IncludePath(rootDir)
+		if _, err := os.Stat(conf.Directories.DataDir); err == nil {
+			signatureDirs = append(signatureDirs, conf.Directories.DataDir)
+		}
+		signature := signature.ScanDirs(signatureDirs, addLanguages)
+
+		// Wrapper for launch jobs, gets all the variables into place and in scope
+		launcher := func(file string, locale string, pofile *po.File, tt job.PostInfoType) {
+
+			// Build up what we need to know about the project, that
+			// the templates will ask about.
+			td := &job.TemplateData{
+				GitInfo:          p.gitInfo,
+				PoMap:            languages.ByLanguage,
+				Locale:           pofile.GetLocale(),
+				Lang:             pofile.GetLang(),
+				LangUC:           pofile.GetLangUC(),
+				Basename:         strings.Split(file, ".")[0],
+				AddLanguage:      addLanguages,
+				TypeMaps:         conf.Options.TypeMaps,
+				Encodings:        precompress.Select(conf.Encodings()),
+				NginxLanguageMap: languages.NginxLanguageMap(),
+				CaddyLanguageMap: languages.CaddyLanguageMap(),
+				DirSignature:     signature,
+				Vars:             conf.Vars,
+				Data:             p.dataByLocale[pofile.GetLocale()],
+				Sites:            p.sites,
+				Profile:          conf.Profile,
+			}
+			if !fingerprinted {
+				td.Assets = p.assets
+			}
+
+			qi := &job.QueueItem{
+				Config:   conf,
+				RootDir:  rootDir,
+				Filename: file,
+				PoFile:   pofile,
+				Data:     td,
+				PostInfo: tt,
+				Cache:    p.cache,
+				Files:    p.files,
+				Parsed:   p.parsed,
+				Assets:   p.assets,
+				Report:   p.report,
+				Manifest: p.manifest,
+			}
+			p.jobTracker.Add(qi)
+			count++
+			if tt.MultiLocale && conf.Options.TypeMaps {
+				typeMaps[job.OutputName(qi)] = true
+			}
+		}
+
+		// Start launching specific jobs
+		for _, file := range files {
+			rule, err := conf.MatchRule(dir, file)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if rule == nil || rule.Fingerprint != fingerprinted || (want != nil && !want(dir, file)) {
+				continue
+			}
+			tt := postInfo(conf, rule)
+			//		log.Printf("file=%s\n", file)
+			launcher(file, "en_US", languages.NewPot, tt)
+			if tt.MultiLocale {
+				for locale, pofile := range languages.ByLanguage {
+					launcher(file, locale, pofile, tt)
+				}
+			}
+		}
+	}
+
+	return count
+}
+
+// writeManifest lists everything in the output directory, with where
+// it came from, in manifest.json.  started is when the build began.
+func (p *project) writeManifest(started time.Time) {
+	dir := p.conf.Directories.OutputDir
+	m := p.manifest
+	m.Build.Started = started
+	m.Build.Finished = time.Now()
+	m.Build.Seconds = m.Build.Finished.Sub(started).Seconds()
+	if err := m.Scan(dir); err != nil {
+		log.Fatal(err)
+	}
+	if err := m.Save(dir); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("%v files listed in %s\n", len(m.Files), manifest.Name)
+}
+
+// writeExtras writes what isn't built from templates: the site list,
+// images, and a couple of symlinks.
+func (p *project) writeExtras() {
+	conf := p.conf
+
+	// The site list, for people and scripts that want it.
+	writeSitesYAML(p.sites, conf.Directories.OutputDir+"/sites.yaml")
+
+	// Copy images
+	copyFiles(conf.Directories.ImagesDir, conf.Directories.OutputDir+"/images")
+	copyFiles(conf.Directories.ImagesDir, conf.Directories.OutputDir+"/images-nc")
+	copyFilesAll(conf.Directories.TransparentDir, conf.Directories.OutputDir+"/transparent")
+
+	// A couple last minute symlinks
+	os.Symlink(".", conf.Directories.OutputDir+"/isp")
+	os.Symlink(".", conf.Directories.OutputDir+"/helpdesk")
+}
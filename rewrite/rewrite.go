@@ -0,0 +1,104 @@
+// Package rewrite edits outputs as they are written, such as pointing
+// the gzipped copy of a page at gzipped scripts.  Rules are declared in
+// the config, per pipeline rule, and may apply to only some variants:
+// the plain output, or one of its compressed copies.
+package rewrite
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Plain names the uncompressed output, as a variant.  Compressed copies
+// are named by their encoding, such as gzip; see package precompress.
+const Plain = "plain"
+
+// Rule replaces text in an output.
+type Rule struct {
+	From     string   // Text to find; a regular expression if Regexp is set
+	To       string   // Replacement; with Regexp, $1 and so on are submatches
+	Regexp   bool     // From is a regular expression
+	Variants []string // Which copies to change: plain, or an encoding such as gzip; empty for all
+}
+
+// Check makes sure a rule can be used.
+func (r *Rule) Check() error {
+	if r.From == "" {
+		return fmt.Errorf("From is required")
+	}
+	if r.Regexp {
+		if _, err := compile(r.From); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Applies reports whether the rule changes the named variant.
+func (r *Rule) Applies(variant string) bool {
+	if len(r.Variants) == 0 {
+		return true
+	}
+	for _, v := range r.Variants {
+		if v == variant {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply runs every rule for variant over text, in order.
+func Apply(rules []Rule, variant string, text string) (string, error) {
+	for i := range rules {
+		r := &rules[i]
+		if !r.Applies(variant) {
+			continue
+		}
+		if !r.Regexp {
+			text = strings.Replace(text, r.From, r.To, -1)
+			continue
+		}
+		re, err := compile(r.From)
+		if err != nil {
+			return "", err
+		}
+		text = re.ReplaceAllString(text, r.To)
+	}
+	return text, nil
+}
+
+// Any reports whether some rule changes the named variant.
+func Any(rules []Rule, variant string) bool {
+	for i := range rules {
+		if rules[i].Applies(variant) {
+			return true
+		}
+	}
+	return false
+}
+
+// compiled keeps the expressions rules use, since every job of a
+// pipeline rule shares them.
+var compiled struct {
+	lock  sync.Mutex
+	byexp map[string]*regexp.Regexp
+}
+
+func compile(expr string) (*regexp.Regexp, error) {
+	compiled.lock.Lock()
+	defer compiled.lock.Unlock()
+	if re, ok := compiled.byexp[expr]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	if compiled.byexp == nil {
+		compiled.byexp = make(map[string]*regexp.Regexp)
+	}
+	compiled.byexp[expr] = re
+	return re, nil
+}
@@ -0,0 +1,45 @@
+package rewrite
+
+import "testing"
+
+func TestApply(t *testing.T) {
+	rules := []Rule{
+		{From: `src="/index.js`, To: `src="/index.js.gz`, Variants: []string{"gzip"}},
+		{From: `href="/(\w+)\.css"`, To: `href="/$1.min.css"`, Regexp: true},
+	}
+	text := `<script src="/index.js"></script><link href="/site.css">`
+
+	tests := []struct {
+		variant string
+		want    string
+	}{
+		{Plain, `<script src="/index.js"></script><link href="/site.min.css">`},
+		{"gzip", `<script src="/index.js.gz"></script><link href="/site.min.css">`},
+		{"br", `<script src="/index.js"></script><link href="/site.min.css">`},
+	}
+	for _, tt := range tests {
+		got, err := Apply(rules, tt.variant, text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.variant, got, tt.want)
+		}
+	}
+
+	if !Any(rules[:1], "gzip") || Any(rules[:1], Plain) {
+		t.Error("Any doesn't follow Variants")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	for _, r := range []Rule{{}, {From: "(", Regexp: true}} {
+		if r.Check() == nil {
+			t.Errorf("%+v passed Check", r)
+		}
+	}
+	r := Rule{From: "(", To: "["}
+	if err := r.Check(); err != nil {
+		t.Errorf("literal %q: %v", r.From, err)
+	}
+}
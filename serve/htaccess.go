@@ -0,0 +1,160 @@
+package serve
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// htaccess holds the directives we emulate, gathered from the .htaccess
+// files from the document root down to one directory.
+type htaccess struct {
+	languages map[string][]string // Extension (".fr_FR") to language tags ("fr", "fr-fr")
+	types     map[string]string   // Extension to content type
+	encodings map[string]string   // Extension to content encoding
+	priority  []string            // LanguagePriority, lower case
+	redirects []redirect
+	deny      []*regexp.Regexp // FilesMatch patterns with "deny from all"
+	headers   [][2]string      // Header append name value
+	handler   string           // SetHandler, such as mod_ip
+}
+
+// redirect is a mod_alias Redirect: paths starting with From go to To,
+// plus whatever followed From.
+type redirect struct {
+	Status int
+	From   string
+	To     string
+}
+
+func newHtaccess() *htaccess {
+	return &htaccess{
+		languages: make(map[string][]string),
+		types:     make(map[string]string),
+		encodings: make(map[string]string),
+	}
+}
+
+// loadHtaccess reads the .htaccess files for dir (relative to root, and
+// cleaned), outermost first, so that inner ones win.
+func loadHtaccess(root string, dir string) *htaccess {
+	h := newHtaccess()
+	path := root
+	h.parseFile(filepath.Join(path, ".htaccess"))
+	for _, part := range strings.Split(strings.Trim(dir, "/"), "/") {
+		if part == "" {
+			continue
+		}
+		path = filepath.Join(path, part)
+		h.parseFile(filepath.Join(path, ".htaccess"))
+	}
+	return h
+}
+
+// parseFile applies one .htaccess file.  Directives we don't emulate are
+// ignored, as are <IfModule> conditions: we assume every module is there.
+func (h *htaccess) parseFile(fn string) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	var filesMatch *regexp.Regexp
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		words := splitDirective(s.Text())
+		if len(words) == 0 || strings.HasPrefix(words[0], "#") {
+			continue
+		}
+		args := words[1:]
+		switch strings.ToLower(strings.Trim(words[0], "<>")) {
+		case "filesmatch":
+			if len(args) > 0 {
+				filesMatch, _ = regexp.Compile(strings.TrimSuffix(args[0], ">"))
+			}
+		case "/filesmatch":
+			filesMatch = nil
+		case "deny":
+			if filesMatch != nil {
+				h.deny = append(h.deny, filesMatch)
+			}
+		case "addlanguage":
+			for _, ext := range args[1:] {
+				ext = dotted(ext)
+				h.languages[ext] = append(h.languages[ext], strings.ToLower(args[0]))
+			}
+		case "addtype":
+			for _, ext := range args[1:] {
+				h.types[dotted(ext)] = args[0]
+			}
+		case "removetype":
+			for _, ext := range args {
+				delete(h.types, dotted(ext))
+			}
+		case "addencoding":
+			for _, ext := range args[1:] {
+				h.encodings[dotted(ext)] = strings.TrimPrefix(args[0], "x-")
+			}
+		case "languagepriority":
+			h.priority = nil
+			for _, tag := range args {
+				h.priority = append(h.priority, strings.ToLower(tag))
+			}
+		case "redirect":
+			if len(args) == 3 {
+				status, err := strconv.Atoi(args[0])
+				if err != nil {
+					status = 302
+				}
+				h.redirects = append(h.redirects, redirect{status, args[1], args[2]})
+			} else if len(args) == 2 {
+				h.redirects = append(h.redirects, redirect{302, args[0], args[1]})
+			}
+		case "header":
+			if len(args) == 3 && strings.EqualFold(args[0], "append") {
+				h.headers = append(h.headers, [2]string{args[1], args[2]})
+			}
+		case "sethandler":
+			if len(args) == 1 {
+				h.handler = args[0]
+			}
+		}
+	}
+}
+
+// splitDirective splits a line into words, keeping "quoted strings" whole.
+func splitDirective(line string) []string {
+	words := []string{}
+	line = strings.TrimSpace(line)
+	for line != "" {
+		if line[0] == '"' {
+			end := strings.Index(line[1:], `"`)
+			if end < 0 {
+				words = append(words, line[1:])
+				break
+			}
+			words = append(words, line[1:end+1])
+			line = strings.TrimSpace(line[end+2:])
+			continue
+		}
+		end := strings.IndexAny(line, " \t")
+		if end < 0 {
+			words = append(words, line)
+			break
+		}
+		words = append(words, line[:end])
+		line = strings.TrimSpace(line[end:])
+	}
+	return words
+}
+
+func dotted(ext string) string {
+	if strings.HasPrefix(ext, ".") {
+		return ext
+	}
+	return "." + ext
+}
@@ -0,0 +1,269 @@
+package serve
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// variant is one file that can answer a request, with what its
+// extensions say about it.
+type variant struct {
+	path      string
+	ctype     string
+	encoding  string
+	languages []string // Lower case tags, such as "fr" and "fr-fr"
+}
+
+// size is the variant's file size.
+func (v *variant) size() int64 {
+	fi, err := os.Stat(v.path)
+	if err != nil {
+		return 0
+	}
+	return fi.Size()
+}
+
+// language is the tag to report in Content-Language: the most specific
+// one, with the region in upper case ("fr-FR").
+func (v *variant) language() string {
+	best := ""
+	for _, tag := range v.languages {
+		if len(tag) > len(best) {
+			best = tag
+		}
+	}
+	if i := strings.Index(best, "-"); i > 0 {
+		best = best[:i] + strings.ToUpper(best[i:])
+	}
+	return best
+}
+
+// describe works out a variant from the extensions of its file name.
+// The extensions past the first len(base) bytes must all mean something
+// to us, or it returns false: MultiViews ignores such files.
+func (h *htaccess) describe(path string, base string) (*variant, bool) {
+	v := &variant{path: path}
+	ok := true
+	name := filepath.Base(path)
+	exts := strings.Split(name, ".")[1:]
+	at := strings.Index(name, ".") + 1
+	for _, ext := range exts {
+		past := at >= len(base)
+		at += len(ext) + 1
+		if ext == "" {
+			continue
+		}
+		ext = "." + ext
+		known := false
+		if tags, ok := h.languages[ext]; ok {
+			v.languages, known = tags, true
+		}
+		if enc, ok := h.encodings[ext]; ok {
+			v.encoding, known = enc, true
+		}
+		if ct, ok := h.types[ext]; ok {
+			v.ctype, known = ct, true
+		} else if ct := builtinType(ext); ct != "" {
+			v.ctype, known = ct, true
+		}
+		if !known && past {
+			ok = false
+		}
+	}
+	return v, ok
+}
+
+// variants lists the files MultiViews would consider for path, which
+// doesn't exist itself: those named path plus one or more extensions.
+func (h *htaccess) variants(path string) []*variant {
+	dir, base := filepath.Split(path)
+	base += "."
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil
+	}
+	names, _ := f.Readdirnames(-1)
+	f.Close()
+	sort.Strings(names)
+
+	found := []*variant{}
+	for _, name := range names {
+		if !strings.HasPrefix(name, base) {
+			continue
+		}
+		if v, ok := h.describe(filepath.Join(dir, name), base); ok {
+			if fi, err := os.Stat(v.path); err == nil && fi.Mode().IsRegular() {
+				found = append(found, v)
+			}
+		}
+	}
+	return found
+}
+
+// acceptItem is one entry of an Accept-* header.
+type acceptItem struct {
+	value string
+	q     float64
+}
+
+// parseAccept splits an Accept-Language or Accept-Encoding header.
+func parseAccept(header string) []acceptItem {
+	items := []acceptItem{}
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		value := strings.ToLower(strings.TrimSpace(fields[0]))
+		if value == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if f, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = f
+				}
+			}
+		}
+		items = append(items, acceptItem{value, q})
+	}
+	return items
+}
+
+// languageQuality is how much the client wants a variant with these
+// language tags.  A range matches a tag equal to it, or starting with
+// it and a "-" ("fr" matches "fr-fr").  Variants without a language
+// are acceptable to anyone, just a little less so.
+func languageQuality(accept []acceptItem, tags []string) float64 {
+	if len(tags) == 0 {
+		return 0.001
+	}
+	best := 0.0
+	for _, a := range accept {
+		for _, tag := range tags {
+			if a.value == "*" || a.value == tag || strings.HasPrefix(tag, a.value+"-") {
+				if a.q > best {
+					best = a.q
+				}
+			}
+		}
+	}
+	return best
+}
+
+// accepts reports whether the client will take content coded as enc.
+func accepts(accept []acceptItem, enc string) bool {
+	if enc == "" {
+		return true
+	}
+	for _, a := range accept {
+		if (a.value == enc || a.value == "x-"+enc || a.value == "*") && a.q > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// priorityRank is a variant's place in LanguagePriority; lower is better.
+func (h *htaccess) priorityRank(tags []string) int {
+	for i, p := range h.priority {
+		for _, tag := range tags {
+			if tag == p {
+				return i
+			}
+		}
+	}
+	return len(h.priority)
+}
+
+// choose picks the variant to send, the way Apache does with
+// ForceLanguagePriority Prefer Fallback: the language the client wants
+// most, with LanguagePriority breaking ties and standing in when nothing
+// is acceptable; then the smallest encoding the client takes, if
+// compressed is true, or else the uncompressed one.
+func (h *htaccess) choose(vs []*variant, acceptLanguage string, acceptEncoding string, compressed bool) *variant {
+	if len(vs) == 0 {
+		return nil
+	}
+	langs := parseAccept(acceptLanguage)
+	encs := parseAccept(acceptEncoding)
+
+	var best *variant
+	bestQ, bestRank := -1.0, 0
+	for _, v := range vs {
+		q := languageQuality(langs, v.languages)
+		rank := h.priorityRank(v.languages)
+		if q > bestQ || (q == bestQ && rank < bestRank) {
+			best, bestQ, bestRank = v, q, rank
+		}
+	}
+	if bestQ == 0 {
+		// Nothing acceptable: fall back to LanguagePriority alone.
+		for _, v := range vs {
+			if rank := h.priorityRank(v.languages); rank < bestRank {
+				best, bestRank = v, rank
+			}
+		}
+	}
+
+	// Among the encodings of that language, take the one the client
+	// prefers.
+	var chosen *variant
+	for _, v := range vs {
+		if !sameLanguage(v, best) || !accepts(encs, v.encoding) {
+			continue
+		}
+		switch {
+		case chosen == nil:
+			chosen = v
+		case !compressed:
+			if v.encoding == "" {
+				chosen = v
+			}
+		case v.size() < chosen.size():
+			chosen = v
+		}
+	}
+	if chosen == nil {
+		chosen = best
+	}
+	return chosen
+}
+
+func sameLanguage(a *variant, b *variant) bool {
+	return strings.Join(a.languages, ",") == strings.Join(b.languages, ",")
+}
+
+// builtinType covers the types Apache knows from mime.types, for the
+// extensions a build writes.
+func builtinType(ext string) string {
+	switch ext {
+	case ".html":
+		return "text/html"
+	case ".js":
+		return "application/javascript"
+	case ".css":
+		return "text/css"
+	case ".php":
+		return "text/plain" // We can't run it; show it
+	case ".json":
+		return "application/json"
+	case ".yaml":
+		return "text/yaml"
+	case ".png":
+		return "image/png"
+	case ".gif":
+		return "image/gif"
+	case ".jpg":
+		return "image/jpeg"
+	case ".svg":
+		return "image/svg+xml"
+	case ".ico":
+		return "image/x-icon"
+	case ".txt":
+		return "text/plain"
+	}
+	return ""
+}
@@ -0,0 +1,583 @@
+package serve
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/falling-sky/builder/gitinfo"
+	"github.com/falling-sky/builder/job"
+	"github.com/falling-sky/builder/po"
+	"github.com/falling-sky/builder/precompress"
+)
+
+// This checks that the Apache, nginx and Caddy configurations in
+// templates/apache route a set of requests the same way.  Apache is
+// played by Server; the others by small interpreters for just the parts
+// of their syntax the templates use.
+
+// routed is what a server did with a request.
+type routed struct {
+	Status   int
+	Location string
+	Type     string
+	Body     string // Decoded
+	Expires  string
+}
+
+func (r routed) String() string {
+	return fmt.Sprintf("%d %q type=%q expires=%q body=%q", r.Status, r.Location, r.Type, r.Expires, r.Body)
+}
+
+type routeRequest struct {
+	path, lang, enc string
+}
+
+// renderApache renders one template from templates/apache.
+func renderApache(t *testing.T, file string, languages *po.Files) string {
+	td := &job.TemplateData{
+		GitInfo:          &gitinfo.GitInfo{Version: "1.0"},
+		Locale:           "en_US",
+		Lang:             "en",
+		Basename:         strings.Split(file, ".")[0],
+		AddLanguage:      languages.ApacheAddLanguage(),
+		NginxLanguageMap: languages.NginxLanguageMap(),
+		CaddyLanguageMap: languages.CaddyLanguageMap(),
+		DirSignature:     "abc",
+		Encodings:        precompress.All(),
+	}
+	qi := &job.QueueItem{RootDir: "../templates/apache", Filename: file, PoFile: &po.File{Language: "en_US"}, Data: td}
+	src, err := job.Expand(qi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := job.Render(qi, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func gzipped(s string) string {
+	b := &bytes.Buffer{}
+	w := gzip.NewWriter(b)
+	w.Write([]byte(s))
+	w.Close()
+	return b.String()
+}
+
+// routingTree writes a build output, with the .htaccess files rendered
+// from the real templates.
+func routingTree(t *testing.T, languages *po.Files) string {
+	root, err := ioutil.TempDir("", "routing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		".htaccess":           renderApache(t, "dot.htaccess", languages),
+		"ip/.htaccess":        renderApache(t, "ip.htaccess", languages),
+		"images/.htaccess":    renderApache(t, "images.htaccess", languages),
+		"images-nc/.htaccess": renderApache(t, "images-nc.htaccess", languages),
+		"images/logo.png":     "logo",
+		"images-nc/dot.gif":   "dot",
+		"private.js.example":  "secret",
+		"sites.yaml":          "sites: []",
+		"index.css":           "css",
+		"index.css.gz":        gzipped("css"),
+	}
+	for _, locale := range []string{"en_US", "fr_FR"} {
+		for _, page := range []string{"index.html", "index.js"} {
+			body := page + " " + locale
+			files[page+"."+locale] = body
+			files[page+".gz."+locale] = gzipped(body)
+		}
+	}
+	files["faq.html.en_US"] = "faq en_US"
+	files["faq.html.gz.en_US"] = gzipped("faq en_US")
+	for name, content := range files {
+		fn := filepath.Join(root, name)
+		os.MkdirAll(filepath.Dir(fn), 0755)
+		if err := ioutil.WriteFile(fn, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(".", filepath.Join(root, "isp")); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+// finish fills in the body and type of a file being served.
+func finish(r routed, fn string, ctype string, encoding string) routed {
+	b, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return routed{Status: 404}
+	}
+	if encoding == "gzip" {
+		zr, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return routed{Status: 500, Body: err.Error()}
+		}
+		b, _ = ioutil.ReadAll(zr)
+	}
+	if ctype == "" {
+		ctype = mime.TypeByExtension(path.Ext(fn))
+	}
+	r.Status, r.Type, r.Body = 200, ctype, string(b)
+	return r
+}
+
+func normalType(ctype string) string {
+	return strings.ToLower(strings.Replace(ctype, " ", "", -1))
+}
+
+func apacheRoute(s *Server, req routeRequest) routed {
+	w := get(s, req.path, "Accept-Language", req.lang, "Accept-Encoding", req.enc)
+	r := routed{Status: w.Code, Location: w.Header().Get("Location"), Expires: w.Header().Get("Expires")}
+	if w.Code != 200 {
+		return r
+	}
+	body := w.Body.String()
+	if w.Header().Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(strings.NewReader(body))
+		if err != nil {
+			return routed{Status: 500, Body: err.Error()}
+		}
+		b, _ := ioutil.ReadAll(zr)
+		body = string(b)
+	}
+	r.Type, r.Body = normalType(w.Header().Get("Content-Type")), body
+	return r
+}
+
+// tokens splits a config line into words, keeping "quoted strings"
+// whole, and dropping # comments.
+func tokens(line string) []string {
+	words := []string{}
+	for line = strings.TrimSpace(line); line != "" && line[0] != '#'; line = strings.TrimSpace(line) {
+		if line[0] == '"' {
+			end := strings.Index(line[1:], `"`) + 1
+			words = append(words, line[1:end])
+			line = line[end+1:]
+			continue
+		}
+		end := strings.IndexAny(line, " \t")
+		if end < 0 {
+			end = len(line)
+		}
+		words = append(words, line[:end])
+		line = line[end:]
+	}
+	return words
+}
+
+// block is a directive, with the directives inside its { } if any.
+type block struct {
+	args []string
+	body []*block
+}
+
+// parseBlocks reads nested blocks from lines of words, where a
+// directive ends at a line end or ";", and "{" opens a block.
+func parseBlocks(text string) *block {
+	top := &block{}
+	stack := []*block{top}
+	for _, line := range strings.Split(text, "\n") {
+		words := tokens(line)
+		cur := []string{}
+		flush := func(open bool) {
+			b := &block{args: cur}
+			parent := stack[len(stack)-1]
+			if len(cur) > 0 || open {
+				parent.body = append(parent.body, b)
+			}
+			if open {
+				stack = append(stack, b)
+			}
+			cur = []string{}
+		}
+		for _, w := range words {
+			switch {
+			case w == "{":
+				flush(true)
+			case w == "}":
+				if len(cur) > 0 {
+					flush(false)
+				}
+				stack = stack[:len(stack)-1]
+			case strings.HasSuffix(w, ";"):
+				cur = append(cur, strings.TrimSuffix(w, ";"))
+				flush(false)
+			default:
+				cur = append(cur, w)
+			}
+		}
+		if len(cur) > 0 {
+			flush(false)
+		}
+	}
+	return top
+}
+
+// mapValue evaluates an nginx or Caddy map: patterns starting with "~"
+// are regular expressions, "~*" ones without case.
+func mapValue(m *block, input string) string {
+	def := ""
+	for _, e := range m.body {
+		pattern, value := e.args[0], ""
+		if len(e.args) > 1 {
+			value = e.args[1]
+		}
+		switch {
+		case pattern == "default":
+			def = value
+		case strings.HasPrefix(pattern, "~*"):
+			if regexp.MustCompile("(?i)" + pattern[2:]).MatchString(input) {
+				return value
+			}
+		case strings.HasPrefix(pattern, "~"):
+			if regexp.MustCompile(pattern[1:]).MatchString(input) {
+				return value
+			}
+		case pattern == input:
+			return value
+		}
+	}
+	return def
+}
+
+func exists(fn string) bool {
+	fi, err := os.Stat(fn)
+	return err == nil && fi.Mode().IsRegular()
+}
+
+func acceptsGzip(enc string) bool {
+	return strings.Contains(enc, "gzip")
+}
+
+func nginxRoute(conf *block, root string, req routeRequest) routed {
+	maps := make(map[string]*block)
+	var server *block
+	for _, b := range conf.body {
+		switch b.args[0] {
+		case "map":
+			maps[strings.TrimPrefix(b.args[2], "$")] = b
+		case "server":
+			server = b
+		}
+	}
+	vars := map[string]string{
+		"http_accept_language": req.lang,
+		"http_accept_encoding": req.enc,
+	}
+	varRE := regexp.MustCompile(`\$(\d|\w+)`)
+	expand := func(s string, captures []string) string {
+		return varRE.ReplaceAllStringFunc(s, func(v string) string {
+			name := v[1:]
+			if n, err := strconv.Atoi(name); err == nil {
+				return captures[n]
+			}
+			if m, ok := maps[name]; ok {
+				return mapValue(m, vars[strings.TrimPrefix(m.args[1], "$")])
+			}
+			return vars[name]
+		})
+	}
+
+	uri := req.path
+	for redirects := 0; redirects < 10; redirects++ {
+		vars["uri"] = uri
+		var loc *block
+		for _, b := range server.body {
+			if b.args[0] == "location" && b.args[1] == "^~" && strings.HasPrefix(uri, b.args[2]) {
+				loc = b
+			}
+		}
+		for _, b := range server.body {
+			if loc == nil && b.args[0] == "location" && b.args[1] == "~" && regexp.MustCompile(b.args[2]).MatchString(uri) {
+				loc = b
+			}
+		}
+		if loc == nil {
+			return finish(routed{}, filepath.Join(root, uri), "", "")
+		}
+
+		r := routed{}
+		types, defaultType, gzipStatic := true, "", false
+		headers := [][]string{}
+		restart := false
+		for _, d := range loc.body {
+			args := d.args[1:]
+			switch d.args[0] {
+			case "deny":
+				return routed{Status: 403}
+			case "return":
+				code, _ := strconv.Atoi(args[0])
+				return routed{Status: code, Location: expand(args[1], nil)}
+			case "rewrite":
+				re := regexp.MustCompile(args[0])
+				if m := re.FindStringSubmatch(uri); m != nil {
+					uri = expand(args[1], m)
+					restart = true
+				}
+			case "types":
+				types = false
+			case "default_type":
+				defaultType = args[0]
+			case "gzip_static":
+				gzipStatic = args[0] == "on"
+			case "add_header":
+				headers = append(headers, args)
+			case "try_files":
+				found := false
+				for _, f := range args[:len(args)-1] {
+					candidate := expand(f, nil)
+					if exists(filepath.Join(root, candidate)) {
+						uri, found = candidate, true
+						break
+					}
+				}
+				if !found {
+					return routed{Status: 404}
+				}
+				vars["uri"] = uri
+			}
+			if restart {
+				break
+			}
+		}
+		if restart {
+			continue
+		}
+
+		fn := filepath.Join(root, uri)
+		ctype, encoding := defaultType, ""
+		if types && mime.TypeByExtension(path.Ext(fn)) != "" {
+			ctype = mime.TypeByExtension(path.Ext(fn))
+		}
+		for _, h := range headers {
+			value := expand(h[1], nil)
+			switch {
+			case value == "":
+			case h[0] == "Expires":
+				r.Expires = value
+			case h[0] == "Content-Encoding":
+				encoding = value
+			}
+		}
+		if gzipStatic && acceptsGzip(req.enc) && exists(fn+".gz") {
+			fn, encoding = fn+".gz", "gzip"
+		}
+		return finish(r, fn, normalType(ctype), encoding)
+	}
+	return routed{Status: 500, Body: "rewrite loop"}
+}
+
+// caddyMatch evaluates a matcher: @name, or an inline path pattern.
+func caddyMatch(matchers map[string]*block, m string, p string) bool {
+	if strings.HasPrefix(m, "@") {
+		def := matchers[m]
+		switch def.args[1] {
+		case "path_regexp":
+			return regexp.MustCompile(def.args[2]).MatchString(p)
+		case "path":
+			for _, pattern := range def.args[2:] {
+				if caddyMatch(matchers, pattern, p) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	switch {
+	case strings.HasPrefix(m, "*") && strings.HasSuffix(m, "*"):
+		return strings.Contains(p, m[1:len(m)-1])
+	case strings.HasPrefix(m, "*"):
+		return strings.HasSuffix(p, m[1:])
+	case strings.HasSuffix(m, "*"):
+		return strings.HasPrefix(p, m[:len(m)-1])
+	}
+	return m == p
+}
+
+func isMatcher(arg string) bool {
+	return strings.HasPrefix(arg, "@") || strings.HasPrefix(arg, "/") || strings.HasPrefix(arg, "*")
+}
+
+func caddyRoute(conf *block, root string, req routeRequest) routed {
+	var site *block
+	for _, b := range conf.body {
+		site = b
+	}
+	maps := make(map[string]*block)
+	var route *block
+	for _, b := range site.body {
+		switch b.args[0] {
+		case "map":
+			maps[strings.Trim(b.args[2], "{}")] = b
+		case "route":
+			route = b
+		}
+	}
+	p := req.path
+	placeholderRE := regexp.MustCompile(`\{[\w.-]+\}`)
+	expand := func(s string) string {
+		return placeholderRE.ReplaceAllStringFunc(s, func(ph string) string {
+			name := strings.Trim(ph, "{}")
+			switch {
+			case name == "path":
+				return p
+			case name == "header.Accept-Language":
+				return req.lang
+			case name == "header.Accept-Encoding":
+				return req.enc
+			}
+			if m, ok := maps[name]; ok {
+				input := req.enc
+				if m.args[1] == "{header.Accept-Language}" {
+					input = req.lang
+				}
+				return mapValue(m, input)
+			}
+			return ph
+		})
+	}
+
+	matchers := make(map[string]*block)
+	r := routed{}
+	ctype, encoding, precompressed := "", "", false
+	for _, d := range route.body {
+		name, args := d.args[0], d.args[1:]
+		if strings.HasPrefix(name, "@") {
+			matchers[name] = d
+			continue
+		}
+		if len(args) > 0 && isMatcher(args[0]) && !(name == "redir" && len(args) == 1) {
+			if !caddyMatch(matchers, args[0], p) {
+				continue
+			}
+			args = args[1:]
+		}
+		switch name {
+		case "respond":
+			code, _ := strconv.Atoi(args[0])
+			return routed{Status: code}
+		case "redir":
+			code, _ := strconv.Atoi(args[1])
+			return routed{Status: code, Location: expand(args[0])}
+		case "rewrite":
+			p = expand(args[0])
+		case "try_files":
+			for _, f := range args {
+				if candidate := expand(f); exists(filepath.Join(root, candidate)) {
+					p = candidate
+					break
+				}
+			}
+		case "header":
+			switch args[0] {
+			case "Expires":
+				r.Expires = args[1]
+			case "Content-Encoding":
+				encoding = args[1]
+			case "Content-Type":
+				ctype = args[1]
+			}
+		case "file_server":
+			for _, sub := range d.body {
+				if sub.args[0] == "precompressed" {
+					precompressed = true
+				}
+			}
+			fn := filepath.Join(root, p)
+			if !exists(fn) {
+				return routed{Status: 404}
+			}
+			if precompressed && encoding == "" && acceptsGzip(req.enc) && exists(fn+".gz") {
+				fn, encoding = fn+".gz", "gzip"
+			}
+			if ctype == "" {
+				ctype = mime.TypeByExtension(path.Ext(p))
+			}
+			return finish(r, fn, normalType(ctype), encoding)
+		}
+	}
+	return routed{Status: 404}
+}
+
+func TestRoutingEquivalence(t *testing.T) {
+	languages := &po.Files{ByLanguage: po.MapStringFile{"fr_FR": &po.File{Language: "fr_FR"}}}
+	root := routingTree(t, languages)
+	defer os.RemoveAll(root)
+
+	apache := New(root, false)
+	nginx := parseBlocks(renderApache(t, "nginx.conf.example", languages))
+	caddy := parseBlocks(renderApache(t, "Caddyfile.example", languages))
+
+	paths := []string{"/", "/index.html", "/index.js", "/faq.html", "/index.css", "/sites.yaml",
+		"/isp/", "/isp/faq.html", "/missing.html", "/private.js.example", "/.htaccess",
+		"/images/.htaccess", "/htrev/", "/images/logo.png", "/images-nc/dot.gif"}
+	langs := []string{"", "fr", "fr-FR", "fr-CA", "de", "en-US,fr;q=0.5", "fr-fr, en;q=0.1",
+		"de, fr;q=0.5", "en-GB,fr;q=0.9", "xx, fr"}
+	encs := []string{"", "gzip, deflate"}
+
+	// nginx and Caddy go by the first language named, ignoring q values,
+	// as their configs say; Apache weighs them all.  So they are held to
+	// what Apache does for the first language alone, and these are the
+	// only headers where that may differ from Apache.
+	firstOnly := map[string]bool{"de, fr;q=0.5": true, "en-GB,fr;q=0.9": true, "xx, fr": true}
+	differs := map[string]bool{}
+
+	results := map[string]string{}
+	for _, p := range paths {
+		for _, lang := range langs {
+			for _, enc := range encs {
+				req := routeRequest{p, lang, enc}
+				want := apacheRoute(apache, req)
+				first := apacheRoute(apache, routeRequest{p, strings.Split(lang, ",")[0], enc})
+				if first != want {
+					differs[lang] = true
+				}
+				if first != want && !firstOnly[lang] {
+					t.Errorf("%+v: apache routes the first language alone to %v, but the header to %v", req, first, want)
+				}
+				for name, got := range map[string]routed{
+					"nginx": nginxRoute(nginx, root, req),
+					"caddy": caddyRoute(caddy, root, req),
+				} {
+					if got != first {
+						t.Errorf("%s %+v:\n got %v\nwant %v (apache, for the first language)", name, req, got, first)
+					}
+				}
+				results[want.Body] = p
+			}
+		}
+	}
+
+	// Make sure the matrix covered what it should.
+	for lang := range firstOnly {
+		if !differs[lang] {
+			t.Errorf("%q routes the same for Apache as its first language alone; take it out of firstOnly", lang)
+		}
+	}
+	seen := []string{}
+	for body := range results {
+		seen = append(seen, body)
+	}
+	sort.Strings(seen)
+	for _, want := range []string{"index.html fr_FR", "index.html en_US", "index.js fr_FR", "faq en_US", "css", "logo"} {
+		if _, ok := results[want]; !ok {
+			t.Errorf("no request returned %q; got %q", want, seen)
+		}
+	}
+}
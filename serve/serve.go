@@ -0,0 +1,247 @@
+// Package serve previews a build over HTTP, standing in for the Apache
+// setup it is written for: MultiViews negotiation on Accept-Language and
+// Accept-Encoding, the redirects and access rules in the generated
+// .htaccess files, and mod_ip.
+package serve
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ReloadPath is where pages listen for rebuilds, when live reload is on.
+const ReloadPath = "/__builder/reload"
+
+// reloadScript is added to HTML pages when live reload is on.
+const reloadScript = `<script>new EventSource("` + ReloadPath + `").onmessage = function() { location.reload(); };</script>`
+
+// Server serves a build directory.
+type Server struct {
+	Root   string // The output directory; symlinks are followed
+	Reload bool   // Add live reload to pages; see Reloaded
+
+	lock    sync.Mutex
+	clients map[chan bool]bool
+}
+
+// New returns a Server for root.
+func New(root string, reload bool) *Server {
+	return &Server{Root: root, Reload: reload, clients: make(map[chan bool]bool)}
+}
+
+// ListenAndServe serves on addr until it fails.
+func (s *Server) ListenAndServe(addr string) error {
+	log.Printf("serving %s on http://%s/\n", s.Root, addr)
+	return http.ListenAndServe(addr, s)
+}
+
+// Reloaded tells every open page to reload.
+func (s *Server) Reloaded() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for c := range s.clients {
+		select {
+		case c <- true:
+		default: // Already has one pending
+		}
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.Reload && r.URL.Path == ReloadPath {
+		s.events(w, r)
+		return
+	}
+	upath := path.Clean("/" + r.URL.Path)
+	if strings.HasSuffix(r.URL.Path, "/") && upath != "/" {
+		upath += "/"
+	}
+	dir := upath
+	if !strings.HasSuffix(dir, "/") {
+		dir = path.Dir(dir)
+	}
+	h := loadHtaccess(s.Root, dir)
+
+	for _, rd := range h.redirects {
+		if strings.HasPrefix(upath, rd.From) {
+			http.Redirect(w, r, rd.To+upath[len(rd.From):], rd.Status)
+			return
+		}
+	}
+	for _, re := range h.deny {
+		if re.MatchString(path.Base(upath)) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+	}
+	if strings.HasPrefix(path.Base(upath), ".ht") {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	for _, hdr := range h.headers {
+		w.Header().Add(hdr[0], hdr[1])
+	}
+	if h.handler == "mod_ip" {
+		modIP(w, r)
+		return
+	}
+
+	fn := filepath.Join(s.Root, filepath.FromSlash(upath))
+	if fi, err := os.Stat(fn); err == nil && fi.IsDir() {
+		if !strings.HasSuffix(upath, "/") {
+			http.Redirect(w, r, upath+"/", http.StatusMovedPermanently)
+			return
+		}
+		fn = filepath.Join(fn, "index.html")
+	}
+
+	var v *variant
+	if fi, err := os.Stat(fn); err == nil && fi.Mode().IsRegular() {
+		v, _ = h.describe(fn, filepath.Base(fn))
+	} else {
+		vs := h.variants(fn)
+		acceptLanguage := r.Header.Get("Accept-Language")
+		if lang := r.URL.Query().Get("lang"); lang != "" {
+			acceptLanguage = strings.Replace(lang, "_", "-", -1)
+		}
+		v = h.choose(vs, acceptLanguage, r.Header.Get("Accept-Encoding"), !s.Reload)
+		w.Header().Set("Vary", "negotiate,accept-language,accept-encoding")
+	}
+	if v == nil {
+		http.NotFound(w, r)
+		return
+	}
+	s.send(w, r, v)
+}
+
+// send writes out a variant, with headers to match.
+func (s *Server) send(w http.ResponseWriter, r *http.Request, v *variant) {
+	f, err := os.Open(v.path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if v.ctype != "" {
+		w.Header().Set("Content-Type", v.ctype)
+	} else {
+		w.Header().Set("Content-Type", "application/octet-stream")
+	}
+	if v.encoding != "" {
+		w.Header().Set("Content-Encoding", v.encoding)
+	}
+	if lang := v.language(); lang != "" {
+		w.Header().Set("Content-Language", lang)
+	}
+
+	if s.Reload && v.encoding == "" && strings.HasPrefix(v.ctype, "text/html") {
+		b, err := ioutil.ReadAll(f)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-cache")
+		http.ServeContent(w, r, "", fi.ModTime(), bytes.NewReader(injectReload(b)))
+		return
+	}
+	http.ServeContent(w, r, "", fi.ModTime(), f)
+}
+
+// injectReload adds the live reload script to a page, before </body> if
+// it has one.
+func injectReload(b []byte) []byte {
+	i := bytes.LastIndex(bytes.ToLower(b), []byte("</body>"))
+	if i < 0 {
+		return append(b, reloadScript...)
+	}
+	out := append([]byte{}, b[:i]...)
+	out = append(out, reloadScript...)
+	return append(out, b[i:]...)
+}
+
+// events holds a server-sent events stream open, and sends a message
+// each time the build changes.
+func (s *Server) events(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	c := make(chan bool, 1)
+	s.lock.Lock()
+	s.clients[c] = true
+	s.lock.Unlock()
+	defer func() {
+		s.lock.Lock()
+		delete(s.clients, c)
+		s.lock.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepalive := time.NewTicker(30 * time.Second)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+		case <-c:
+			fmt.Fprint(w, "data: reload\n\n")
+		}
+		flusher.Flush()
+	}
+}
+
+// modIP answers the way mod_ip does: the client's address as JSON,
+// wrapped in the callback if one is given, and padded out to fill bytes.
+// ASN lookups aren't emulated.
+func modIP(w http.ResponseWriter, r *http.Request) {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	kind := "ipv4"
+	if strings.Contains(ip, ":") {
+		kind = "ipv6"
+	}
+	reply := map[string]string{"ip": ip, "type": kind, "subtype": "", "via": "", "padding": ""}
+	q := r.URL.Query()
+	encode := func() string {
+		b, _ := json.Marshal(reply)
+		if cb := q.Get("callback"); cb != "" {
+			return cb + "(" + string(b) + ")"
+		}
+		return string(b)
+	}
+	body := encode()
+	var fill int
+	if _, err := fmt.Sscan(q.Get("fill"), &fill); err == nil && fill > len(body) {
+		reply["padding"] = strings.Repeat("x", fill-len(body))
+		body = encode()
+	}
+	w.Header().Set("Content-Type", "application/javascript")
+	w.Header().Set("Cache-Control", "no-cache")
+	fmt.Fprint(w, body)
+}
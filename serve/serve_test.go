@@ -0,0 +1,177 @@
+package serve
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testHtaccess = `Options +MultiViews
+LanguagePriority en-us en
+ForceLanguagePriority prefer fallback
+AddLanguage en .en_US
+AddLanguage en-US .en_US
+AddLanguage fr .fr_FR
+AddLanguage fr-FR .fr_FR
+AddType "text/html;charset=UTF-8" .html
+RemoveType .gz
+AddEncoding x-gzip .gz
+<FilesMatch "private">
+order allow,deny
+deny from all
+</FilesMatch>
+Redirect 307 /htrev/ /?htrev=1.0-abc
+`
+
+func testTree(t *testing.T) string {
+	root, err := ioutil.TempDir("", "serve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		".htaccess":            testHtaccess,
+		"index.html.en_US":     "<html><body>english</body></html>",
+		"index.html.gz.en_US":  "gz english",
+		"index.html.fr_FR":     "<html><body>french</body></html>",
+		"index.html.gz.fr_FR":  "gz french",
+		"private.js.example":   "secret",
+		"ip/.htaccess":         "SetHandler mod_ip\n",
+		"images/.htaccess":     `Header append Expires "Mon, 01 Jan 2035 00:00:00 GMT"` + "\n",
+		"images/logo.png":      "png",
+		"faq.html.en_US":       "<html><body>faq</body></html>",
+		"sites_parsed.js.gz":   "odd",
+		"sites_parsed.js.oops": "unknown extension",
+	}
+	for name, content := range files {
+		fn := filepath.Join(root, name)
+		os.MkdirAll(filepath.Dir(fn), 0755)
+		if err := ioutil.WriteFile(fn, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(".", filepath.Join(root, "isp")); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func get(s *Server, url string, headers ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("GET", url, nil)
+	for i := 0; i+1 < len(headers); i += 2 {
+		r.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	return w
+}
+
+func TestNegotiation(t *testing.T) {
+	root := testTree(t)
+	defer os.RemoveAll(root)
+	s := New(root, false)
+
+	tests := []struct {
+		url, lang, enc string
+		body, ctlang   string
+	}{
+		{"/", "", "", "english", "en-US"},
+		{"/", "fr", "", "french", "fr-FR"},
+		{"/", "de, fr;q=0.5", "", "french", "fr-FR"},
+		{"/", "de", "", "english", "en-US"},
+		{"/", "fr;q=0.5, en", "", "english", "en-US"},
+		{"/", "fr", "gzip, deflate", "gz french", "fr-FR"},
+		{"/index.html", "en", "gzip", "gz english", "en-US"},
+		{"/?lang=fr_FR", "en", "", "french", "fr-FR"},
+		{"/isp/", "fr", "", "french", "fr-FR"},
+		{"/isp/faq.html", "fr", "", "faq", "en-US"},
+		{"/index.html.fr_FR", "en", "gzip", "french", "fr-FR"},
+	}
+	for _, tt := range tests {
+		w := get(s, tt.url, "Accept-Language", tt.lang, "Accept-Encoding", tt.enc)
+		body := w.Body.String()
+		if w.Code != 200 || !strings.Contains(body, tt.body) {
+			t.Errorf("%s (%q, %q): got %v %q, want %q", tt.url, tt.lang, tt.enc, w.Code, body, tt.body)
+			continue
+		}
+		if got := w.Header().Get("Content-Language"); got != tt.ctlang {
+			t.Errorf("%s (%q): Content-Language %q, want %q", tt.url, tt.lang, got, tt.ctlang)
+		}
+		wantEnc := ""
+		if strings.HasPrefix(tt.body, "gz ") {
+			wantEnc = "gzip"
+		}
+		if got := w.Header().Get("Content-Encoding"); got != wantEnc {
+			t.Errorf("%s (%q): Content-Encoding %q, want %q", tt.url, tt.enc, got, wantEnc)
+		}
+	}
+
+	if w := get(s, "/index.html"); !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+		t.Errorf("Content-Type %q, want text/html", w.Header().Get("Content-Type"))
+	}
+	if w := get(s, "/missing.html"); w.Code != 404 {
+		t.Errorf("/missing.html: got %v, want 404", w.Code)
+	}
+	if w := get(s, "/sites_parsed.js"); w.Code != 200 || w.Body.String() != "odd" {
+		t.Errorf("/sites_parsed.js: got %v %q, want the .gz variant only", w.Code, w.Body.String())
+	}
+}
+
+func TestRules(t *testing.T) {
+	root := testTree(t)
+	defer os.RemoveAll(root)
+	s := New(root, false)
+
+	w := get(s, "/htrev/extra")
+	if w.Code != http.StatusTemporaryRedirect || w.Header().Get("Location") != "/?htrev=1.0-abcextra" {
+		t.Errorf("/htrev/: got %v %q", w.Code, w.Header().Get("Location"))
+	}
+	for _, url := range []string{"/private.js.example", "/.htaccess", "/ip/.htaccess"} {
+		if w := get(s, url); w.Code != http.StatusForbidden {
+			t.Errorf("%s: got %v, want 403", url, w.Code)
+		}
+	}
+	if w := get(s, "/images"); w.Code != http.StatusMovedPermanently {
+		t.Errorf("/images: got %v, want a redirect to /images/", w.Code)
+	}
+	w = get(s, "/images/logo.png")
+	if w.Header().Get("Expires") == "" || w.Header().Get("Content-Type") != "image/png" {
+		t.Errorf("/images/logo.png: headers %v", w.Header())
+	}
+	w = get(s, "/ip/?callback=cb&fill=100")
+	if body := w.Body.String(); !strings.HasPrefix(body, `cb({"ip":"192.0.2.1"`) || len(body) != 100 {
+		t.Errorf("/ip/: got %q (%v bytes)", body, len(body))
+	}
+}
+
+func TestReload(t *testing.T) {
+	root := testTree(t)
+	defer os.RemoveAll(root)
+	s := New(root, true)
+
+	w := get(s, "/", "Accept-Encoding", "gzip")
+	body := w.Body.String()
+	if w.Header().Get("Content-Encoding") != "" {
+		t.Errorf("live reload should prefer uncompressed pages")
+	}
+	if !strings.Contains(body, ReloadPath+`").onmessage = function() { location.reload(); };</script></body>`) {
+		t.Errorf("reload script not injected: %q", body)
+	}
+
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	resp, err := http.Get(ts.URL + ReloadPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	s.Reloaded()
+	buf := make([]byte, 64)
+	n, _ := resp.Body.Read(buf)
+	if got := string(buf[:n]); got != "data: reload\n\n" {
+		t.Errorf("event stream: got %q", got)
+	}
+}
@@ -10,9 +10,30 @@ import (
 	"github.com/falling-sky/builder/fileutil"
 )
 
+// ScanDir returns a signature covering the template files in directory,
+// plus any extra strings passed in.
 func ScanDir(directory string, otherstuff ...string) string {
+	return ScanDirs([]string{directory}, otherstuff...)
+}
+
+// ScanDirs is ScanDir for several directories, such as a template root
+// along with the shared directories on its include path.
+func ScanDirs(directories []string, otherstuff ...string) string {
 	h := md5.New()
 
+	for _, directory := range directories {
+		scanDir(h, directory)
+	}
+
+	// Any other stuff we passed, to bias a signature.
+	// Such as languages.
+	for _, s := range otherstuff {
+		io.WriteString(h, s)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+func scanDir(h io.Writer, directory string) {
 	log.Printf("ScanDir(%s)", directory)
 	files, err := fileutil.FilesInDirRecursive(directory)
 	if err != nil {
@@ -20,26 +41,18 @@ func ScanDir(directory string, otherstuff ...string) string {
 	}
 	for _, file := range files {
 		e := filepath.Ext(file)
-		if e != ".html" && e != ".js" && e != ".htaccess" && e != ".inc" && e != ".example" && e != ".php" {
+		if e != ".html" && e != ".js" && e != ".htaccess" && e != ".inc" && e != ".example" && e != ".php" && e != ".json" && e != ".yaml" && e != ".yml" {
 			continue
 		}
 
 		fn := directory + "/" + file
 		//	log.Printf("scanning %s\n", fn)
 
-		// This will cache, saving a trip for other jobs
-		content, err := fileutil.ReadFile(fn)
+		content, err := fileutil.ReadFileNoCache(fn)
 		if err != nil {
 			log.Fatal(err)
 		}
 		io.WriteString(h, content)
 
 	}
-
-	// Any other stuff we passed, to bias a signature.
-	// Such as languages.
-	for _, s := range otherstuff {
-		io.WriteString(h, s)
-	}
-	return fmt.Sprintf("%x", h.Sum(nil))
 }
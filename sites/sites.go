@@ -0,0 +1,171 @@
+package sites
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/falling-sky/builder/data"
+	"gopkg.in/yaml.v2"
+)
+
+// Site is a single partner site or mirror.  The field order here is the
+// order they appear in the generated JavaScript.
+type Site struct {
+	Site     string `json:"site" yaml:"site"`
+	Mirror   bool   `json:"mirror" yaml:"mirror,omitempty"`
+	Hide     bool   `json:"hide" yaml:"hide,omitempty"`
+	V4       string `json:"v4" yaml:"v4"`
+	V6       string `json:"v6" yaml:"v6"`
+	Loc      string `json:"loc" yaml:"loc"`
+	Provider string `json:"provider" yaml:"provider"`
+	Monitor  string `json:"monitor" yaml:"monitor,omitempty"`
+	Reason   string `json:"reason" yaml:"reason,omitempty"`
+}
+
+// List is the canonical set of sites, sorted by name.
+type List struct {
+	Sites []*Site
+}
+
+// reLOC matches a location: a country code, optionally followed by a
+// region as either "US CA" or "US (CA)".  "global" is also accepted.
+var reLOC = regexp.MustCompile(`^([A-Z]{2})(?: [A-Z]{2}| \([A-Z]{2}\))?$`)
+
+// Load reads a sites file (JSON or YAML, as a list of sites) and validates it.
+func Load(fn string) (*List, error) {
+	b, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+	generic, err := data.Decode(fn, b)
+	if err != nil {
+		return nil, err
+	}
+
+	// Round trip through JSON, so that both formats decode strictly.
+	j, err := json.Marshal(generic)
+	if err != nil {
+		return nil, err
+	}
+	l := &List{}
+	dec := json.NewDecoder(bytes.NewReader(j))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&l.Sites); err != nil {
+		return nil, fmt.Errorf("%s: %v", fn, err)
+	}
+
+	if errs := l.Validate(); len(errs) > 0 {
+		msgs := []string{}
+		for _, e := range errs {
+			msgs = append(msgs, e.Error())
+		}
+		return nil, fmt.Errorf("%s: %s", fn, strings.Join(msgs, "; "))
+	}
+	sort.Slice(l.Sites, func(i, j int) bool { return l.Sites[i].Site < l.Sites[j].Site })
+	return l, nil
+}
+
+// checkURL makes sure a probe URL is absolute http(s), and returns its host.
+func checkURL(s string) (string, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("%q is not an http or https URL", s)
+	}
+	if u.Hostname() == "" {
+		return "", fmt.Errorf("%q has no host name", s)
+	}
+	return u.Hostname(), nil
+}
+
+// Validate checks every site, returning all of the problems found.
+func (l *List) Validate() []error {
+	errs := []error{}
+	seen := make(map[string]bool)
+	for i, s := range l.Sites {
+		bad := func(format string, args ...interface{}) {
+			name := s.Site
+			if name == "" {
+				name = fmt.Sprintf("entry %d", i+1)
+			}
+			errs = append(errs, fmt.Errorf("%s: %s", name, fmt.Sprintf(format, args...)))
+		}
+
+		if s.Site == "" {
+			bad("missing site")
+		} else if seen[s.Site] {
+			bad("listed more than once")
+		}
+		seen[s.Site] = true
+
+		v4, err := checkURL(s.V4)
+		if err != nil {
+			bad("v4: %v", err)
+		}
+		v6, err := checkURL(s.V6)
+		if err != nil {
+			bad("v6: %v", err)
+		}
+		if v4 != "" && v4 == v6 {
+			bad("v4 and v6 both use %s; they must be different host names", v4)
+		}
+
+		if s.Loc != "global" {
+			m := reLOC.FindStringSubmatch(s.Loc)
+			if m == nil || !isCountry(m[1]) {
+				bad("loc %q is not an ISO country code (optionally followed by a region)", s.Loc)
+			}
+		}
+		if s.Provider == "" {
+			bad("missing provider")
+		}
+	}
+	return errs
+}
+
+// ByName returns the sites keyed by name, as the JavaScript expects.
+func (l *List) ByName() map[string]*Site {
+	m := make(map[string]*Site)
+	if l == nil {
+		return m
+	}
+	for _, s := range l.Sites {
+		m[s.Site] = s
+	}
+	return m
+}
+
+// JSON renders the sites as the object GIGO.sites_parsed holds.
+func (l *List) JSON() (string, error) {
+	b, err := json.MarshalIndent(l.ByName(), "", " ")
+	return string(b), err
+}
+
+// YAML renders the sites keyed by name, for people and scripts.
+func (l *List) YAML() (string, error) {
+	b, err := yaml.Marshal(l.ByName())
+	return string(b), err
+}
+
+// Mirrors returns the visible mirrors, sorted by location and then name.
+func (l *List) Mirrors() []*Site {
+	found := []*Site{}
+	if l == nil {
+		return found
+	}
+	for _, s := range l.Sites {
+		if s.Mirror && !s.Hide {
+			found = append(found, s)
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool { return found[i].Loc < found[j].Loc })
+	return found
+}
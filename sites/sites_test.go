@@ -0,0 +1,70 @@
+package sites
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadCanonical(t *testing.T) {
+	l, err := Load("../templates/data/sites.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := l.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The generated object must match what used to be copied by hand.
+	b, err := ioutil.ReadFile("testdata/sites_parsed_raw.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.TrimSpace(string(b)); got != want {
+		t.Errorf("JSON differs from testdata/sites_parsed_raw.json")
+	}
+	if len(l.Mirrors()) == 0 {
+		t.Errorf("expected some mirrors")
+	}
+	if _, err := l.YAML(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	var table = []struct {
+		yaml string
+		want string
+	}{
+		{"- {site: a.com, v4: 'http://ipv4.a.com/x.png', v6: 'http://ipv6.a.com/x.png', loc: US CA, provider: A}", ""},
+		{"- {site: a.com, v4: 'http://ipv4.a.com/x.png', v6: 'http://ipv6.a.com/x.png', loc: global, provider: A}", ""},
+		{"- {site: a.com, v4: 'http://ipv4.a.com/x.png', v6: 'http://ipv6.a.com/x.png', loc: US (VA), provider: A}", ""},
+		{"- {site: a.com, v4: 'http://ipv4.a.com/x.png', v6: 'http://ipv6.a.com/x.png', loc: US, provider: A}\n" +
+			"- {site: a.com, v4: 'http://ipv4.a.com/x.png', v6: 'http://ipv6.a.com/x.png', loc: US, provider: A}", "listed more than once"},
+		{"- {site: a.com, v4: 'http://www.a.com/x.png', v6: 'http://www.a.com/y.png', loc: US, provider: A}", "must be different host names"},
+		{"- {site: a.com, v4: 'ipv4.a.com/x.png', v6: 'http://ipv6.a.com/x.png', loc: US, provider: A}", "not an http or https URL"},
+		{"- {site: a.com, v4: 'http://ipv4.a.com/x.png', v6: 'http://ipv6.a.com/x.png', loc: XQ, provider: A}", "not an ISO country code"},
+		{"- {site: a.com, v4: 'http://ipv4.a.com/x.png', v6: 'http://ipv6.a.com/x.png', loc: US, provider: A, color: red}", "unknown field"},
+	}
+
+	dir, err := ioutil.TempDir("", "sites_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn := filepath.Join(dir, "sites.yaml")
+
+	for _, tt := range table {
+		ioutil.WriteFile(fn, []byte(tt.yaml), 0644)
+		_, err := Load(fn)
+		switch {
+		case tt.want == "" && err != nil:
+			t.Errorf("%s: %v", tt.yaml, err)
+		case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+			t.Errorf("%s: got %v, want %q", tt.yaml, err, tt.want)
+		}
+	}
+}
@@ -1,13 +1,46 @@
 package tfuncs
 
 import (
-	"io/ioutil"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/falling-sky/builder/fileutil"
 )
 
-// Include will fetch the named file, and return the contents + error
-// Really, this is just a string version of ioutil.ReadFile; but
-// will potentially in the future offer caching.  Memory is cheap!
-func Include(fn string) (string, error) {
-	b, err := ioutil.ReadFile(fn)
-	return string(b), err
+// resolve finds name under the first of Roots that has it, noting it in
+// Reads.  Names that would escape the roots, via ".." or a symlink, are
+// refused.
+func (o *Options) resolve(name string) (string, error) {
+	o.Reads = append(o.Reads, name)
+	full, _, err := fileutil.Search(o.Roots, name)
+	if err == fileutil.ErrOutside {
+		return "", fmt.Errorf("%q is outside of the template roots", name)
+	}
+	return full, err
+}
+
+// Include will fetch the named file from the template roots, and return
+// the contents + error.  The contents are not expanded as a template.
+func (o *Options) Include(name string) (string, error) {
+	fn, err := o.resolve(name)
+	if err == os.ErrNotExist {
+		return "", fmt.Errorf("include %q: not found in %s", name, strings.Join(o.Roots, ", "))
+	}
+	if err != nil {
+		return "", err
+	}
+	return o.Files.ReadFile(fn)
+}
+
+// ReadFile is Include for optional files: a missing file is simply empty.
+func (o *Options) ReadFile(name string) (string, error) {
+	fn, err := o.resolve(name)
+	if err == os.ErrNotExist {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return o.Files.ReadFile(fn)
 }
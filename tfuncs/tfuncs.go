@@ -0,0 +1,129 @@
+package tfuncs
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/url"
+	"reflect"
+	"sort"
+	"text/template"
+	"time"
+
+	"github.com/falling-sky/builder/fileutil"
+)
+
+// gitDateLayout is what "git log --format=%cd" produces.
+const gitDateLayout = "Mon Jan 2 15:04:05 2006 -0700"
+
+// Options describe the environment the functions run in.
+type Options struct {
+	Roots   []string                          // Directories include and readFile may read from
+	Files   *fileutil.FileCache               // Read through, if set
+	Version string                            // Used for cache busting by the default Asset
+	Asset   func(name string) (string, error) // Maps an output file name to its URL
+	Reads   []string                          // Every name include and readFile looked up, found or not
+}
+
+// Func describes a single template function.
+type Func struct {
+	Name  string
+	Usage string
+	Help  string
+	Impl  interface{}
+}
+
+// List returns every template function, bound to these options.
+func List(o *Options) []Func {
+	return []Func{
+		{"include", `include "inc/file.txt"`, "Contents of a file from the template roots, not expanded", o.Include},
+		{"readFile", `readFile "inc/optional.txt"`, "Like include, but a missing file is empty", o.ReadFile},
+		{"json", `json .Value`, "Value encoded as JSON", JSON},
+		{"jsEscape", `jsEscape "text"`, "Text escaped for a JavaScript string", template.JSEscapeString},
+		{"htmlAttr", `htmlAttr "text"`, "Text escaped for an HTML attribute value", html.EscapeString},
+		{"urlquery", `urlquery "text"`, "Text escaped for a URL query parameter", url.QueryEscape},
+		{"date", `date "2006-01-02" .GitInfo.Date`, "Reformat a git commit date using a Go time layout", Date},
+		{"sortedKeys", `range sortedKeys .PoMap`, "Keys of a map, sorted", SortedKeys},
+		{"percent", `percent .Translated .OutOf`, "Whole percentage of part over total; 0 if total is 0", Percent},
+		{"default", `.Value | default "fallback"`, "The value, or the fallback if the value is empty", Default},
+		{"asset", `asset "index.css"`, "URL of a generated file, suitable for long caching", o.asset},
+	}
+}
+
+// FuncMap returns the functions ready for template.Funcs.
+func FuncMap(o *Options) template.FuncMap {
+	fm := make(template.FuncMap)
+	for _, f := range List(o) {
+		fm[f.Name] = f.Impl
+	}
+	return fm
+}
+
+// asset uses the configured resolver, falling back to ?version= cache busting.
+func (o *Options) asset(name string) (string, error) {
+	if o.Asset != nil {
+		return o.Asset(name)
+	}
+	return "/" + name + "?version=" + url.QueryEscape(o.Version), nil
+}
+
+// JSON encodes a value as JSON.
+func JSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+// Date parses a git commit date, and formats it with a Go time layout.
+func Date(layout string, gitdate string) (string, error) {
+	t, err := time.Parse(gitDateLayout, gitdate)
+	if err != nil {
+		return "", err
+	}
+	return t.Format(layout), nil
+}
+
+// SortedKeys returns the keys of a map with string keys, sorted.
+func SortedKeys(m interface{}) ([]string, error) {
+	v := reflect.ValueOf(m)
+	if v.Kind() != reflect.Map || v.Type().Key().Kind() != reflect.String {
+		return nil, fmt.Errorf("sortedKeys: need a map with string keys, got %T", m)
+	}
+	keys := []string{}
+	for _, k := range v.MapKeys() {
+		keys = append(keys, k.String())
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Percent returns part/total as a whole percentage, rounded down.
+func Percent(part int, total int) int {
+	if total == 0 {
+		return 0
+	}
+	return part * 100 / total
+}
+
+// Default returns value, unless it is empty (the zero value, or an
+// empty string, slice or map); then it returns def.
+func Default(def interface{}, value interface{}) interface{} {
+	if value == nil {
+		return def
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		if v.Len() == 0 {
+			return def
+		}
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return def
+		}
+	default:
+		if v.IsZero() {
+			return def
+		}
+	}
+	return value
+}
@@ -0,0 +1,112 @@
+package tfuncs
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func render(t *testing.T, o *Options, text string, data interface{}) (string, error) {
+	tmpl, err := template.New("test").Funcs(FuncMap(o)).Parse(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &bytes.Buffer{}
+	err = tmpl.Execute(b, data)
+	return b.String(), err
+}
+
+func TestFuncs(t *testing.T) {
+	o := &Options{Version: "1.2.3"}
+	data := map[string]interface{}{
+		"Map":   map[string]int{"pt_BR": 1, "de_DE": 2, "fr_FR": 3},
+		"Empty": "",
+		"Name":  "Jason",
+		"Date":  "Mon Oct 5 21:08:41 2015 +0000",
+		"List":  []string{"a", "b"},
+	}
+
+	var table = []struct {
+		in  string
+		out string
+	}{
+		{`{{json .List}}`, `["a","b"]`},
+		{`{{json "<b>"}}`, `"\u003cb\u003e"`},
+		{`{{jsEscape "it's \"x\""}}`, `it\'s \"x\"`},
+		{`{{htmlAttr "a\"b<c>&'"}}`, `a&#34;b&lt;c&gt;&amp;&#39;`},
+		{`{{urlquery "a b&c"}}`, `a+b%26c`},
+		{`{{date "2006-01-02" .Date}}`, `2015-10-05`},
+		{`{{range sortedKeys .Map}}{{.}} {{end}}`, `de_DE fr_FR pt_BR `},
+		{`{{percent 1 3}}`, `33`},
+		{`{{percent 5 0}}`, `0`},
+		{`{{.Empty | default "none"}}`, `none`},
+		{`{{.Name | default "none"}}`, `Jason`},
+		{`{{0 | default 7}}`, `7`},
+		{`{{asset "index.css"}}`, `/index.css?version=1.2.3`},
+	}
+	for _, tt := range table {
+		got, err := render(t, o, tt.in, data)
+		if err != nil {
+			t.Errorf("%s: %v", tt.in, err)
+			continue
+		}
+		if got != tt.out {
+			t.Errorf("%s: got %q, want %q", tt.in, got, tt.out)
+		}
+	}
+
+	if _, err := render(t, o, `{{date "2006" "yesterday"}}`, nil); err == nil {
+		t.Error("date accepted a bad date")
+	}
+	if _, err := render(t, o, `{{sortedKeys 3}}`, nil); err == nil {
+		t.Error("sortedKeys accepted a non-map")
+	}
+
+	o.Asset = func(name string) (string, error) { return "/" + name + ".abc123", nil }
+	if got, _ := render(t, o, `{{asset "index.css"}}`, nil); got != "/index.css.abc123" {
+		t.Errorf("asset with resolver: got %q", got)
+	}
+}
+
+func TestIncludeSandbox(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tfuncs_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "html", "inc"), 0755)
+	os.MkdirAll(filepath.Join(dir, "shared"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "html", "inc", "a.txt"), []byte("local [% x %]"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "shared", "b.txt"), []byte("shared"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "secret.txt"), []byte("secret"), 0644)
+
+	o := &Options{Roots: []string{filepath.Join(dir, "html"), filepath.Join(dir, "shared")}}
+
+	var table = []struct {
+		in  string
+		out string
+		err string
+	}{
+		{`{{include "inc/a.txt"}}`, "local [% x %]", ""},
+		{`{{include "b.txt"}}`, "shared", ""},
+		{`{{readFile "missing.txt"}}`, "", ""},
+		{`{{include "missing.txt"}}`, "", "not found"},
+		{`{{include "../secret.txt"}}`, "", "outside of the template roots"},
+		{`{{readFile "../secret.txt"}}`, "", "outside of the template roots"},
+	}
+	for _, tt := range table {
+		got, err := render(t, o, tt.in, nil)
+		switch {
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%s: got error %v, want %q", tt.in, err, tt.err)
+		case tt.err == "" && err != nil:
+			t.Errorf("%s: %v", tt.in, err)
+		case tt.err == "" && got != tt.out:
+			t.Errorf("%s: got %q, want %q", tt.in, got, tt.out)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/falling-sky/builder/fileutil"
+	"github.com/falling-sky/builder/po"
+	"github.com/falling-sky/builder/precompress"
+)
+
+// typeMapTypes are the content types dot.htaccess gives with AddType.
+var typeMapTypes = map[string]string{
+	".html": "text/html;charset=UTF-8",
+	".js":   "text/javascript;charset=UTF-8",
+	".css":  "text/css;charset=UTF-8",
+	".yaml": "text/plain;charset=UTF-8",
+}
+
+// typeMap returns an Apache type map for name, given the files that are
+// variants of it: name.LOCALE, or compressed, such as name.gz.LOCALE.  The en_US variants
+// have a slightly higher source quality, so that they win ties, such as
+// for "Accept-Language: *" or no Accept-Language at all.  Files that
+// aren't variants are left out.
+func typeMap(name string, files []string, tags []po.LanguageTag) string {
+	byLocale := make(map[string][]string)
+	for _, t := range tags {
+		byLocale[t.Locale] = append(byLocale[t.Locale], t.Tag)
+	}
+
+	b := &bytes.Buffer{}
+	base := filepath.Base(name)
+	fmt.Fprintf(b, "URI: %s\n\n", base)
+	sort.Strings(files)
+	for _, f := range files {
+		rest := strings.TrimPrefix(f, base+".")
+		encoding := ""
+		for _, e := range precompress.All() {
+			if strings.HasPrefix(rest, e.Short()+".") {
+				rest, encoding = rest[len(e.Short())+1:], e.Name
+			}
+		}
+		langs, ok := byLocale[rest]
+		if !ok || f == rest {
+			continue
+		}
+		qs := "0.999"
+		if rest == "en_US" {
+			qs = "1.0"
+		}
+		ctype := typeMapTypes[filepath.Ext(base)]
+		if ctype == "" {
+			ctype = "application/octet-stream"
+		}
+		fmt.Fprintf(b, "URI: %s\n", f)
+		fmt.Fprintf(b, "Content-Type: %s; qs=%s\n", ctype, qs)
+		fmt.Fprintf(b, "Content-Language: %s\n", strings.Join(langs, ", "))
+		if encoding != "" {
+			fmt.Fprintf(b, "Content-Encoding: %s\n", encoding)
+		}
+		fmt.Fprintf(b, "\n")
+	}
+	return b.String()
+}
+
+// writeTypeMap writes name.var, next to the variants of name in the
+// output directory.
+func (p *project) writeTypeMap(name string) {
+	fn := filepath.Join(p.conf.Directories.OutputDir, name)
+	files, err := fileutil.FilesInDirNotRecursive(filepath.Dir(fn))
+	if err != nil {
+		log.Fatal(err)
+	}
+	variants := []string{}
+	for _, f := range files {
+		if strings.HasPrefix(f, filepath.Base(name)+".") {
+			variants = append(variants, f)
+		}
+	}
+	err = ioutil.WriteFile(fn+".var", []byte(typeMap(name, variants, p.languages.LanguageTags())), 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
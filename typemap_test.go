@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/falling-sky/builder/po"
+)
+
+func TestTypeMap(t *testing.T) {
+	languages := &po.Files{ByLanguage: po.MapStringFile{"fr_FR": &po.File{Language: "fr_FR"}}}
+	files := []string{"index.html.br.fr_FR", "index.html.gz.fr_FR", "index.html.en_US", "index.html.fr_FR", "index.html.gz.en_US", "index.html.en_US.orig", "index.html.var"}
+	want := `URI: index.html
+
+URI: index.html.br.fr_FR
+Content-Type: text/html;charset=UTF-8; qs=0.999
+Content-Language: fr, fr-FR
+Content-Encoding: br
+
+URI: index.html.en_US
+Content-Type: text/html;charset=UTF-8; qs=1.0
+Content-Language: en, en-US
+
+URI: index.html.fr_FR
+Content-Type: text/html;charset=UTF-8; qs=0.999
+Content-Language: fr, fr-FR
+
+URI: index.html.gz.en_US
+Content-Type: text/html;charset=UTF-8; qs=1.0
+Content-Language: en, en-US
+Content-Encoding: gzip
+
+URI: index.html.gz.fr_FR
+Content-Type: text/html;charset=UTF-8; qs=0.999
+Content-Language: fr, fr-FR
+Content-Encoding: gzip
+
+`
+	if got := typeMap("index.html", files, languages.LanguageTags()); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/falling-sky/builder/config"
+	"github.com/falling-sky/builder/fileutil"
+	"github.com/falling-sky/builder/job"
+	"github.com/falling-sky/builder/serve"
+	"github.com/fsnotify/fsnotify"
+)
+
+// settle is how long to wait for more changes before rebuilding, since
+// editors tend to write a file in several steps.
+const settle = 300 * time.Millisecond
+
+// server previews the build when -listen is given, and reloads open
+// pages after each rebuild.
+var server *serve.Server
+
+// watch builds everything once, then rebuilds whatever is affected each
+// time a template, translation, image, data or config file changes.
+// Rebuilds write straight into the live build, rather than a new one:
+// watch mode is for development.
+func watch() {
+	job.KeepGoing = true
+	for watchConfig() {
+		log.Printf("config changed; starting over\n")
+	}
+}
+
+// watchConfig builds and watches for one version of the config.  It
+// returns true when the config file changes.
+func watchConfig() bool {
+	conf, err := config.Load(*configFileName, configSets...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	p, build := buildAll(conf)
+	defer p.jobTracker.Stop()
+	conf.Directories.OutputDir = build.Dir
+	if *listenAddr != "" && server == nil {
+		server = serve.New(build.Live, true)
+		go func() {
+			log.Fatal(server.ListenAndServe(*listenAddr))
+		}()
+	}
+	reloaded()
+
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer w.Close()
+
+	d := conf.Directories
+	roots := append([]string{d.TemplateDir, d.PoDir, d.ImagesDir, d.TransparentDir, d.DataDir, filepath.Dir(d.SitesFile)}, d.SharedDirs...)
+	if d.OverrideDir != "" {
+		roots = append(roots, d.OverrideDir)
+	}
+	for _, root := range roots {
+		if err := watchTree(w, root); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *configFileName != "" {
+		// Editors often replace files rather than rewrite them, so
+		// watch the directory holding the config, not the file.
+		if err := w.Add(filepath.Dir(*configFileName)); err != nil {
+			log.Fatal(err)
+		}
+	}
+	log.Printf("watching for changes\n")
+
+	changed := make(map[string]fsnotify.Op)
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	for {
+		select {
+		case ev, ok := <-w.Events:
+			if !ok {
+				return false
+			}
+			if strings.HasSuffix(ev.Name, "~") || strings.HasPrefix(filepath.Base(ev.Name), ".") {
+				continue // Editor backups and swap files
+			}
+			if ev.Op&fsnotify.Create != 0 {
+				if fi, err := os.Stat(ev.Name); err == nil && fi.IsDir() {
+					watchTree(w, ev.Name)
+				}
+			}
+			changed[ev.Name] |= ev.Op
+			timer.Reset(settle)
+		case err, ok := <-w.Errors:
+			if !ok {
+				return false
+			}
+			log.Printf("watch: %v\n", err)
+		case <-timer.C:
+			if rebuild(p, changed) {
+				return true
+			}
+			reloaded()
+			changed = make(map[string]fsnotify.Op)
+		}
+	}
+}
+
+// reloaded tells pages open in the preview server that the build changed.
+func reloaded() {
+	if server != nil {
+		server.Reloaded()
+	}
+}
+
+// watchTree watches dir and every directory below it.
+func watchTree(w *fsnotify.Watcher, dir string) error {
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil
+	}
+	return filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			return w.Add(path)
+		}
+		return nil
+	})
+}
+
+// under reports whether path is within dir.
+func under(dir string, path string) bool {
+	if dir == "" {
+		return false
+	}
+	d, err := fileutil.RealPath(dir)
+	if err != nil {
+		return false
+	}
+	return fileutil.Within(d, path)
+}
+
+// replaced reports whether a created or removed path is really a file
+// that was rewritten by replacing it, as editors and git do: it exists,
+// and templates already read it.
+func replaced(p *project, path string) bool {
+	if _, err := os.Stat(path); err != nil {
+		return false
+	}
+	return len(p.parsed.Dependents([]string{path})) > 0
+}
+
+// templateName returns the name Dependents would use for path, if it is a
+// template directly under one of the pipeline directories.
+func templateName(conf *config.Record, path string) (string, bool) {
+	for _, dir := range conf.PipelineDirs() {
+		root := conf.Directories.TemplateDir + "/" + dir
+		if real, err := fileutil.RealPath(root); err == nil && filepath.Dir(path) == real {
+			return root + "/" + filepath.Base(path), true
+		}
+	}
+	return "", false
+}
+
+// rebuild works out what the changed files affect, and rebuilds it.
+// It returns true if the config file changed, since that means
+// starting over.
+func rebuild(p *project, changed map[string]fsnotify.Op) bool {
+	t0 := time.Now()
+	d := p.conf.Directories
+	configFile := ""
+	if *configFileName != "" {
+		configFile, _ = fileutil.RealPath(*configFileName)
+	}
+	sitesFile, _ := fileutil.RealPath(d.SitesFile)
+
+	paths := []string{}
+	everything, languages, data, extras := false, false, false, false
+	for name, op := range changed {
+		path, err := fileutil.RealPath(name)
+		if err != nil {
+			continue
+		}
+		switch {
+		case path == configFile:
+			return true
+		case under(d.PoDir, path):
+			languages = true
+		case path == sitesFile || under(d.DataDir, path):
+			data = true
+		case under(d.ImagesDir, path) || under(d.TransparentDir, path):
+			extras = true
+		case op&(fsnotify.Create|fsnotify.Remove|fsnotify.Rename) != 0 && !replaced(p, path):
+			// A new or missing file can change which file an include
+			// resolves to, or which templates there are at all.
+			everything = true
+		}
+		paths = append(paths, path)
+	}
+
+	// Work out which templates read the changed files, before the
+	// caches forget.  A template is affected by its own change too, even
+	// if it failed before reading anything.
+	affected := make(map[string]bool)
+	for _, name := range p.parsed.Dependents(paths) {
+		affected[name] = true
+	}
+	for _, path := range paths {
+		if name, ok := templateName(p.conf, path); ok {
+			affected[name] = true
+		}
+	}
+	p.files.Changed(paths...)
+
+	if languages {
+		p.loadLanguages()
+	}
+	if data || languages {
+		p.loadData()
+	}
+	if languages || data {
+		everything = true
+	}
+
+	var want func(dir string, file string) bool
+	if !everything {
+		want = func(dir string, file string) bool {
+			return affected[d.TemplateDir+"/"+dir+"/"+file]
+		}
+	}
+	n := 0
+	if everything || len(affected) > 0 {
+		n = p.runJobs(want)
+	}
+	if extras || everything {
+		p.writeExtras()
+	}
+	p.writeManifest(t0)
+	log.Printf("rebuilt %v jobs for %v changed files in %v\n", n, len(changed), time.Since(t0))
+	return false
+}